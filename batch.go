@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/valyala/fasthttp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewBatchRequestOptions parses a batched request, a JSON array of operations
+// sent in a single POST body. It returns nil when the request is not a batch.
+func NewBatchRequestOptions(ctx *fasthttp.RequestCtx) []*RequestOptions {
+	batch, _ := parseBatchRequestOptions(ctx)
+	return batch
+}
+
+// parseBatchRequestOptions parses a batched request along with the error of
+// each malformed operation.
+func parseBatchRequestOptions(ctx *fasthttp.RequestCtx) ([]*RequestOptions, []error) {
+	if !ctx.Request.Header.IsPost() {
+		return nil, nil
+	}
+
+	contentType := strings.Split(string(ctx.Request.Header.ContentType()), ";")[0]
+	if contentType == ContentTypeGraphQL || contentType == ContentTypeFormURLEncoded {
+		return nil, nil
+	}
+
+	if contentType == ContentTypeMultipartFormData {
+		batch, ok, err := parseMultipartRequest(ctx)
+		if !ok {
+			return nil, nil
+		}
+		if err != nil {
+			return []*RequestOptions{{}}, []error{err}
+		}
+		return batch, make([]error, len(batch))
+	}
+
+	body := bytes.TrimSpace(ctx.Request.Body())
+	if len(body) == 0 || body[0] != '[' {
+		return nil, nil
+	}
+
+	var operations []json.RawMessage
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, nil
+	}
+
+	batch := make([]*RequestOptions, len(operations))
+	errs := make([]error, len(operations))
+	for i, operation := range operations {
+		batch[i], errs[i] = newRequestOptionsFromJSON(operation)
+	}
+	return batch, errs
+}
+
+// executeBatch executes every operation of a batch and returns the results in
+// the same order. Up to batchConcurrency operations are executed in parallel.
+func (h *Handler) executeBatch(ctx context.Context, ctxreq *fasthttp.RequestCtx, batch []*RequestOptions, errs []error) []*graphql.Result {
+	results := make([]*graphql.Result, len(batch))
+
+	if h.batchConcurrency < 2 {
+		for i, opts := range batch {
+			results[i] = h.executeBatchOperation(ctx, ctxreq, opts, errs[i])
+		}
+		return results
+	}
+
+	// the operations share the request, so their hooks are serialized
+	ctx = withRequestLock(ctx)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, h.batchConcurrency)
+	for i, opts := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, opts *RequestOptions) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = h.executeBatchOperation(ctx, ctxreq, opts, errs[i])
+		}(i, opts)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// executeBatchOperation executes a single operation of a batch. Malformed
+// operations only fail their own result when GraphQLOverHTTP is enabled.
+func (h *Handler) executeBatchOperation(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, err error) *graphql.Result {
+	start := time.Now()
+	ctx, span := h.startSpan(ctx, SpanOperation)
+	defer span.End()
+
+	if err != nil && h.graphqlOverHTTP {
+		result := h.formatErrors(ctx, newRequestErrorResult(err))
+		h.reportRejection(opts, nil, start, result, h.requestErrorStatus())
+		return h.runResultHook(ctx, ctxreq, opts, result)
+	}
+	result, _ := h.execute(ctx, ctxreq, opts)
+	return h.runResultHook(ctx, ctxreq, opts, result)
+}
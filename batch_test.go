@@ -0,0 +1,89 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"testing"
+)
+
+func decodeBatchResponse(t *testing.T, ctx *fasthttp.RequestCtx) []*graphql.Result {
+	var target []*graphql.Result
+	if err := json.Unmarshal(ctx.Response.Body(), &target); err != nil {
+		t.Fatalf("DecodeBatchResponse(): %v \n%s", err.Error(), ctx.Response.Body())
+	}
+	return target
+}
+
+func TestBatchRequestOptions_NotABatch(t *testing.T) {
+	body := []byte(`{"query": "{ hero { name } }"}`)
+	httpCtx := newHTTPCtx("POST", "/graphql", body)
+	httpCtx.Request.Header.SetContentType("application/json")
+
+	if batch := handler.NewBatchRequestOptions(httpCtx); batch != nil {
+		t.Fatalf("expected nil batch, got %v", batch)
+	}
+}
+
+func TestBatchRequestOptions_WithVariablesAsString(t *testing.T) {
+	body := []byte(` [
+		{"query": "query A { hero { name } }"},
+		{"query": "query B($id: String!) { human(id: $id) { name } }", "variables": "{\"id\": \"1000\"}"}
+	]`)
+	expected := []*handler.RequestOptions{
+		{Query: "query A { hero { name } }"},
+		{
+			Query:     "query B($id: String!) { human(id: $id) { name } }",
+			Variables: map[string]interface{}{"id": "1000"},
+		},
+	}
+	httpCtx := newHTTPCtx("POST", "/graphql", body)
+	httpCtx.Request.Header.SetContentType("application/json")
+
+	result := handler.NewBatchRequestOptions(httpCtx)
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result))
+	}
+}
+
+func TestHandler_BatchQuery(t *testing.T) {
+	body := []byte(`[
+		{"query": "{ hero { name } }"},
+		{"query": "{ unknownField }"},
+		{"query": "query H($id: String!) { human(id: $id) { name } }", "variables": {"id": "1000"}}
+	]`)
+
+	for _, concurrency := range []int{0, 2} {
+		httpCtx := newHTTPCtx("POST", "/graphql", body)
+		httpCtx.Request.Header.SetContentType("application/json")
+
+		h := handler.New(&handler.Config{
+			Schema:           &testutil.StarWarsSchema,
+			BatchConcurrency: concurrency,
+		})
+		h.ServeHTTP(httpCtx)
+
+		if httpCtx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("unexpected server response %v", httpCtx.Response.StatusCode())
+		}
+		results := decodeBatchResponse(t, httpCtx)
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(results))
+		}
+
+		expected := map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}
+		if !reflect.DeepEqual(results[0].Data, expected) || results[0].HasErrors() {
+			t.Fatalf("wrong first result, graphql result diff: %v", testutil.Diff(expected, results[0].Data))
+		}
+		if !results[1].HasErrors() {
+			t.Fatalf("expected the second result to carry its own errors, got %v", results[1])
+		}
+		expected = map[string]interface{}{"human": map[string]interface{}{"name": "Luke Skywalker"}}
+		if !reflect.DeepEqual(results[2].Data, expected) || results[2].HasErrors() {
+			t.Fatalf("wrong third result, graphql result diff: %v", testutil.Diff(expected, results[2].Data))
+		}
+	}
+}
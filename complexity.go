@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"math"
+	"strconv"
+)
+
+// FieldCost holds the cost hints of a field, used to compute the complexity
+// of operations.
+type FieldCost struct {
+	// Cost is the cost of resolving the field itself. Fields without hints
+	// cost 1.
+	Cost int
+
+	// Multipliers lists the arguments whose values multiply the cost of the
+	// selections of the field, such as `first` or `limit` on list fields.
+	Multipliers []string
+}
+
+// complexityWalker computes the cost of selection sets.
+type complexityWalker struct {
+	schema    *graphql.Schema
+	costs     map[string]FieldCost
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+	fragments map[string]*ast.FragmentDefinition
+	memo      map[string]int
+	visiting  map[string]bool
+}
+
+// operationComplexity returns the cost of operation: each field costs its
+// FieldCost.Cost plus the cost of its selections times its multipliers. The
+// cost saturates at math.MaxInt instead of overflowing.
+func operationComplexity(schema *graphql.Schema, costs map[string]FieldCost, doc *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}) int {
+	w := &complexityWalker{
+		schema:    schema,
+		costs:     costs,
+		variables: variables,
+		defaults:  map[string]ast.Value{},
+		fragments: getFragments(doc),
+		memo:      map[string]int{},
+		visiting:  map[string]bool{},
+	}
+	for _, definition := range operation.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			w.defaults[definition.Variable.Name.Value] = definition.DefaultValue
+		}
+	}
+
+	var root graphql.Type
+	switch operation.Operation {
+	case ast.OperationTypeQuery:
+		root = schema.QueryType()
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	}
+	return w.selectionSetCost(operation.SelectionSet, root)
+}
+
+func (w *complexityWalker) selectionSetCost(set *ast.SelectionSet, parent graphql.Type) int {
+	if set == nil {
+		return 0
+	}
+
+	cost := 0
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost = addCost(cost, w.fieldCost(selection, parent))
+		case *ast.InlineFragment:
+			fragmentType := parent
+			if selection.TypeCondition != nil {
+				fragmentType = w.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			cost = addCost(cost, w.selectionSetCost(selection.SelectionSet, fragmentType))
+		case *ast.FragmentSpread:
+			cost = addCost(cost, w.fragmentCost(selection.Name.Value))
+		}
+	}
+	return cost
+}
+
+func (w *complexityWalker) fieldCost(field *ast.Field, parent graphql.Type) int {
+	name := field.Name.Value
+	if name == "__typename" {
+		return 0
+	}
+
+	var definition *graphql.FieldDefinition
+	if fielder, ok := parent.(interface {
+		Fields() graphql.FieldDefinitionMap
+	}); ok {
+		definition = fielder.Fields()[name]
+	}
+	if definition == nil {
+		// introspection fields and unknown fields get the default cost
+		return addCost(1, w.selectionSetCost(field.SelectionSet, nil))
+	}
+
+	hint, ok := w.costs[parent.Name()+"."+name]
+	if !ok {
+		hint = FieldCost{Cost: 1}
+	}
+
+	multiplier := 1
+	for _, argName := range hint.Multipliers {
+		if value, ok := w.argumentInt(field, definition, argName); ok && value > 0 {
+			multiplier = mulCost(multiplier, value)
+		}
+	}
+
+	return addCost(hint.Cost, mulCost(multiplier, w.selectionSetCost(field.SelectionSet, namedType(definition.Type))))
+}
+
+func (w *complexityWalker) fragmentCost(name string) int {
+	if cost, ok := w.memo[name]; ok {
+		return cost
+	}
+
+	fragment, ok := w.fragments[name]
+	if !ok || w.visiting[name] {
+		// unknown fragments and cycles are reported by the validation
+		return 0
+	}
+
+	w.visiting[name] = true
+	cost := w.selectionSetCost(fragment.SelectionSet, w.schema.Type(fragment.TypeCondition.Name.Value))
+	delete(w.visiting, name)
+
+	w.memo[name] = cost
+	return cost
+}
+
+// addCost returns a+b, saturating at math.MaxInt. Costs are never negative
+// since multipliers are positive.
+func addCost(a, b int) int {
+	if b > 0 && a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// mulCost returns a*b, saturating at math.MaxInt for positive operands.
+func mulCost(a, b int) int {
+	if a > 0 && b > 0 && a > math.MaxInt/b {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// argumentInt returns the integer value of an argument of field the way the
+// executor resolves it: variables take their provided value, else the
+// default value of the variable, and omitted arguments or variables fall back
+// to the default value of the argument.
+func (w *complexityWalker) argumentInt(field *ast.Field, definition *graphql.FieldDefinition, name string) (int, bool) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+		variable, ok := arg.Value.(*ast.Variable)
+		if !ok {
+			return literalInt(arg.Value)
+		}
+		if value, ok := w.variables[variable.Name.Value]; ok && value != nil {
+			return toInt(value)
+		}
+		if value, ok := w.defaults[variable.Name.Value]; ok {
+			return literalInt(value)
+		}
+		break
+	}
+
+	for _, arg := range definition.Args {
+		if arg.Name() == name {
+			return toInt(arg.DefaultValue)
+		}
+	}
+	return 0, false
+}
+
+func literalInt(value ast.Value) (int, bool) {
+	if value, ok := value.(*ast.IntValue); ok {
+		i, err := strconv.Atoi(value.Value)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toInt(value interface{}) (int, bool) {
+	switch value := value.(type) {
+	case int:
+		return value, true
+	case float64:
+		return int(value), true
+	}
+	return 0, false
+}
+
+// namedType unwraps the list and non-null wrappers of t.
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapper := t.(type) {
+		case *graphql.List:
+			t = wrapper.OfType
+		case *graphql.NonNull:
+			t = wrapper.OfType
+		default:
+			return t
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/url"
+	"testing"
+)
+
+func newItemsSchema(t *testing.T) graphql.Schema {
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.String},
+			"price": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"items": &graphql.Field{
+					Type: graphql.NewList(item),
+					Args: graphql.FieldConfigArgument{
+						"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{map[string]interface{}{"name": "a", "price": 1}}, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_Complexity(t *testing.T) {
+	cases := map[string]struct {
+		query              string
+		variables          string
+		expectedComplexity float64
+		expectsErrors      bool
+	}{
+		"uses the argument literal as multiplier": {
+			query:              `{ items(first: 5) { name price } }`,
+			expectedComplexity: 2 + 5*(1+3),
+		},
+		"uses the argument default value as multiplier": {
+			query:              `{ items { name } }`,
+			expectedComplexity: 2 + 10*1,
+		},
+		"uses variables as multiplier": {
+			query:              `query Q($n: Int) { items(first: $n) { ...Fields } } fragment Fields on Item { name price }`,
+			variables:          `{"n": 2}`,
+			expectedComplexity: 2 + 2*(1+3),
+		},
+		"uses the variable default value as multiplier": {
+			query:              `query Q($n: Int = 100) { items(first: $n) { name } }`,
+			expectedComplexity: 2 + 100*1,
+			expectsErrors:      true,
+		},
+		"prefers provided variables to their default value": {
+			query:              `query Q($n: Int = 100) { items(first: $n) { name } }`,
+			variables:          `{"n": 3}`,
+			expectedComplexity: 2 + 3*1,
+		},
+		"uses the argument default value for omitted variables": {
+			query:              `query Q($n: Int) { items(first: $n) { name } }`,
+			expectedComplexity: 2 + 10*1,
+		},
+		"ignores __typename": {
+			query:              `{ __typename items(first: 1) { name } }`,
+			expectedComplexity: 2 + 1*1,
+		},
+		"rejects over-budget operations": {
+			query:              `{ items(first: 100) { name } }`,
+			expectedComplexity: 2 + 100*1,
+			expectsErrors:      true,
+		},
+	}
+
+	schema := newItemsSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:        &schema,
+		MaxComplexity: 50,
+		FieldCosts: map[string]handler.FieldCost{
+			"Query.items": {Cost: 2, Multipliers: []string{"first"}},
+			"Item.price":  {Cost: 3},
+		},
+		ReportComplexity: true,
+	})
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			u := "/graphql?query=" + url.QueryEscape(tc.query)
+			if tc.variables != "" {
+				u += "&variables=" + url.QueryEscape(tc.variables)
+			}
+			result := executeTest(t, h, newHTTPCtx("GET", u, nil))
+
+			if result.HasErrors() != tc.expectsErrors {
+				t.Fatalf("wrong errors, expected errors: %v, got %v", tc.expectsErrors, result.Errors)
+			}
+			report, _ := result.Extensions["complexity"].(map[string]interface{})
+			if report["cost"] != tc.expectedComplexity {
+				t.Fatalf("wrong complexity, expected %v, got %v", tc.expectedComplexity, report["cost"])
+			}
+			if report["maximum"] != float64(50) {
+				t.Fatalf("wrong maximum complexity, got %v", report["maximum"])
+			}
+		})
+	}
+}
+
+func newTreeSchema(t *testing.T) graphql.Schema {
+	var node *graphql.Object
+	node = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Node",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.String},
+				"children": &graphql.Field{
+					Type: graphql.NewList(node),
+					Args: graphql.FieldConfigArgument{
+						"first": &graphql.ArgumentConfig{Type: graphql.Int},
+					},
+				},
+			}
+		}),
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"root": &graphql.Field{
+					Type: node,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return map[string]interface{}{"name": "root"}, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_ComplexityOverflow(t *testing.T) {
+	schema := newTreeSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:        &schema,
+		MaxComplexity: 100,
+		FieldCosts: map[string]handler.FieldCost{
+			"Node.children": {Cost: 1, Multipliers: []string{"first"}},
+		},
+	})
+
+	for depth := 1; depth <= 5; depth++ {
+		query := "name"
+		for i := 0; i < depth; i++ {
+			query = "children(first: 2147483647) { " + query + " }"
+		}
+		query = "{ root { " + query + " } }"
+
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query="+url.QueryEscape(query), nil))
+		if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != "COMPLEXITY_LIMIT_EXCEEDED" {
+			t.Fatalf("expected %d nested levels to exceed the maximum complexity, got %v", depth, result)
+		}
+	}
+}
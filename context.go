@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/valyala/fasthttp"
+)
+
+// ContextFn builds the context operations are executed with from the context
+// given to ContextHandler and the request, e.g. to add authentication claims.
+type ContextFn func(ctx context.Context, ctxreq *fasthttp.RequestCtx) context.Context
+
+// requestCtxKey is the context key of the request an operation was sent with.
+type requestCtxKey struct{}
+
+// withRequestCtx returns a copy of ctx holding the request.
+func withRequestCtx(ctx context.Context, ctxreq *fasthttp.RequestCtx) context.Context {
+	return context.WithValue(ctx, requestCtxKey{}, ctxreq)
+}
+
+// RequestCtxFromContext returns the request an operation was sent with, from
+// the context it is executed with, or nil when there is none. Operations
+// executed over WebSocket connections get a copy of the upgrade request.
+func RequestCtxFromContext(ctx context.Context) *fasthttp.RequestCtx {
+	ctxreq, _ := ctx.Value(requestCtxKey{}).(*fasthttp.RequestCtx)
+	return ctxreq
+}
+
+// RequestCtxFromResolveParams returns the request the operation resolving a
+// field was sent with, or nil when there is none.
+func RequestCtxFromResolveParams(p graphql.ResolveParams) *fasthttp.RequestCtx {
+	if p.Context == nil {
+		return nil
+	}
+	return RequestCtxFromContext(p.Context)
+}
+
+// requestContext returns the context of the operations of a request: ctx
+// holding the request, passed through the ContextFn.
+func (h *Handler) requestContext(ctx context.Context, ctxreq *fasthttp.RequestCtx) context.Context {
+	ctx = withRequestCtx(ctx, ctxreq)
+	if h.contextFn != nil {
+		ctx = h.contextFn(ctx, ctxreq)
+	}
+	return ctx
+}
@@ -0,0 +1,69 @@
+package handler_test
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"testing"
+)
+
+func newRequestSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"claims": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Context.Value("claims"), nil
+					},
+				},
+				"userAgent": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						ctxreq := handler.RequestCtxFromResolveParams(p)
+						if ctxreq == nil {
+							return nil, nil
+						}
+						return string(ctxreq.Request.Header.UserAgent()), nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_ContextFn(t *testing.T) {
+	schema := newRequestSchema(t)
+	h := handler.New(&handler.Config{
+		Schema: &schema,
+		ContextFn: func(ctx context.Context, ctxreq *fasthttp.RequestCtx) context.Context {
+			return context.WithValue(ctx, "claims", string(ctxreq.Request.Header.Peek("Authorization")))
+		},
+	})
+
+	ctx := newHTTPCtx("GET", "/graphql?query={claims userAgent}", nil)
+	ctx.Request.Header.Set("Authorization", "Bearer luke")
+	ctx.Request.Header.SetUserAgent("test-agent")
+	result := executeTest(t, h, ctx)
+
+	expected := &graphql.Result{Data: map[string]interface{}{
+		"claims":    "Bearer luke",
+		"userAgent": "test-agent",
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, expected %v, got %v", expected, result)
+	}
+}
+
+func TestRequestCtxFromContext_Missing(t *testing.T) {
+	if ctxreq := handler.RequestCtxFromContext(context.Background()); ctxreq != nil {
+		t.Fatalf("expected no request, got %v", ctxreq)
+	}
+}
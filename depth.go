@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// depthWalker computes the depth of selection sets, remembering the depth of
+// every fragment so documents reusing fragments are walked once.
+type depthWalker struct {
+	fragments map[string]*ast.FragmentDefinition
+	depths    map[string]int
+	visiting  map[string]bool
+}
+
+// operationDepth returns the deepest level of nested fields selected by
+// operation, following fragment spreads.
+func operationDepth(doc *ast.Document, operation *ast.OperationDefinition) int {
+	w := &depthWalker{
+		fragments: getFragments(doc),
+		depths:    map[string]int{},
+		visiting:  map[string]bool{},
+	}
+	return w.selectionSetDepth(operation.SelectionSet)
+}
+
+func (w *depthWalker) selectionSetDepth(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+
+	depth := 0
+	for _, selection := range set.Selections {
+		var d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d = 1 + w.selectionSetDepth(selection.SelectionSet)
+		case *ast.InlineFragment:
+			d = w.selectionSetDepth(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			d = w.fragmentDepth(selection.Name.Value)
+		}
+		if d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+func (w *depthWalker) fragmentDepth(name string) int {
+	if depth, ok := w.depths[name]; ok {
+		return depth
+	}
+
+	fragment, ok := w.fragments[name]
+	if !ok || w.visiting[name] {
+		// unknown fragments and cycles are reported by the validation
+		return 0
+	}
+
+	w.visiting[name] = true
+	depth := w.selectionSetDepth(fragment.SelectionSet)
+	delete(w.visiting, name)
+
+	w.depths[name] = depth
+	return depth
+}
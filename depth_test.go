@@ -0,0 +1,106 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/url"
+	"testing"
+)
+
+func TestHandler_MaxDepth(t *testing.T) {
+	cases := map[string]struct {
+		query         string
+		expectsErrors bool
+	}{
+		"allows operations within the limit": {
+			query: `{ hero { friends { name } } }`,
+		},
+		"rejects over-deep operations": {
+			query:         `{ hero { friends { friends { name } } } }`,
+			expectsErrors: true,
+		},
+		"follows fragments": {
+			query: `
+				{ hero { ...Friends } }
+				fragment Friends on Character { friends { ...Names } }
+				fragment Names on Character { friends { name } }
+			`,
+			expectsErrors: true,
+		},
+		"follows inline fragments": {
+			query:         `{ hero { ... on Droid { friends { friends { name } } } } }`,
+			expectsErrors: true,
+		},
+	}
+
+	h := handler.New(&handler.Config{
+		Schema:   &testutil.StarWarsSchema,
+		MaxDepth: 3,
+	})
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			httpCtx := newHTTPCtx("GET", "/graphql?query="+url.QueryEscape(tc.query), nil)
+			result := executeTest(t, h, httpCtx)
+
+			if result.HasErrors() != tc.expectsErrors {
+				t.Fatalf("wrong errors, expected errors: %v, got %v", tc.expectsErrors, result.Errors)
+			}
+			if tc.expectsErrors && result.Data != nil {
+				t.Fatalf("expected no data, got %v", result.Data)
+			}
+		})
+	}
+}
+
+func TestHandler_MaxDepth_DoesNotInvokeResolvers(t *testing.T) {
+	calls := 0
+	var person *graphql.Object
+	person = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Person",
+		Fields: (graphql.FieldsThunk)(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.String},
+				"friend": &graphql.Field{
+					Type: person,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						calls++
+						return map[string]interface{}{"name": "friend"}, nil
+					},
+				},
+			}
+		}),
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"me": &graphql.Field{
+					Type: person,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						calls++
+						return map[string]interface{}{"name": "me"}, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handler.New(&handler.Config{
+		Schema:   &schema,
+		MaxDepth: 2,
+	})
+	query := url.QueryEscape(`{ me { friend { friend { name } } } }`)
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query="+query, nil))
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("expected a depth error, got %v", result.Errors)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no resolver to be invoked, got %d calls", calls)
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"sync/atomic"
+)
+
+// DefaultDocumentCacheSize is the number of parsed documents cached when
+// Config.DocumentCacheSize is not set.
+const DefaultDocumentCacheSize = 1000
+
+// DocumentCacheStats reports the usage of the parsed document cache.
+type DocumentCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// documentCache caches parsed and validated documents keyed by the schema and
+// the hash of the query text.
+type documentCache struct {
+	// hits and misses are first so they are 64-bit aligned for atomic access
+	hits   uint64
+	misses uint64
+	cache  *lruCache
+}
+
+func newDocumentCache(size int) *documentCache {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = DefaultDocumentCacheSize
+	}
+	return &documentCache{
+		cache: newLRUCache(size),
+	}
+}
+
+// documentHash returns the hex encoded SHA-256 hash of a query.
+func documentHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupDocument returns the cached document of query, along with the key the
+// document is cached under.
+func (h *Handler) lookupDocument(query string) (*ast.Document, string) {
+	if h.documentCache == nil {
+		return nil, ""
+	}
+
+	key := fmt.Sprintf("%p:%s", h.Schema, documentHash(query))
+	if doc, ok := h.documentCache.cache.Get(key); ok {
+		atomic.AddUint64(&h.documentCache.hits, 1)
+		return doc.(*ast.Document), key
+	}
+	atomic.AddUint64(&h.documentCache.misses, 1)
+	return nil, key
+}
+
+// parseDocument parses query.
+func (h *Handler) parseDocument(query string) (*ast.Document, []gqlerrors.FormattedError) {
+	src := source.NewSource(&source.Source{
+		Body: []byte(query),
+		Name: "GraphQL request",
+	})
+	doc, err := parser.Parse(parser.ParseParams{Source: src})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+	return doc, nil
+}
+
+// validateDocument validates doc against the handler schema. Valid documents
+// are cached under key so identical queries skip parsing and validation.
+func (h *Handler) validateDocument(doc *ast.Document, key string) []gqlerrors.FormattedError {
+	validationResult := graphql.ValidateDocument(h.Schema, doc, nil)
+	if !validationResult.IsValid {
+		return validationResult.Errors
+	}
+
+	if h.documentCache != nil {
+		h.documentCache.cache.Add(key, doc)
+	}
+	return nil
+}
+
+// DocumentCacheStats returns the hit and miss counters and the current size of
+// the parsed document cache.
+func (h *Handler) DocumentCacheStats() DocumentCacheStats {
+	if h.documentCache == nil {
+		return DocumentCacheStats{}
+	}
+	return DocumentCacheStats{
+		Hits:   atomic.LoadUint64(&h.documentCache.hits),
+		Misses: atomic.LoadUint64(&h.documentCache.misses),
+		Size:   h.documentCache.cache.Len(),
+	}
+}
+
+// getOperation returns the operation of doc selected by operationName, or nil
+// when there is no such operation.
+func getOperation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	var operation *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" {
+			if operation != nil {
+				// an operation name is required to pick one of several operations
+				return nil
+			}
+			operation = op
+		} else if op.Name != nil && op.Name.Value == operationName {
+			return op
+		}
+	}
+	return operation
+}
+
+// getFragments returns the fragment definitions of doc by name.
+func getFragments(doc *ast.Document) map[string]*ast.FragmentDefinition {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	return fragments
+}
@@ -0,0 +1,53 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"reflect"
+	"testing"
+)
+
+func TestHandler_DocumentCache(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema: &testutil.StarWarsSchema,
+	})
+
+	for i := 0; i < 3; i++ {
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name}}", nil))
+		expected := map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}
+		if result.HasErrors() || !reflect.DeepEqual(result.Data, expected) {
+			t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result.Data))
+		}
+	}
+
+	// invalid documents are never cached
+	for i := 0; i < 2; i++ {
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={unknownField}", nil))
+		if !result.HasErrors() {
+			t.Fatalf("expected validation errors")
+		}
+	}
+
+	expected := handler.DocumentCacheStats{Hits: 2, Misses: 3, Size: 1}
+	if stats := h.DocumentCacheStats(); stats != expected {
+		t.Fatalf("wrong cache stats, expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestHandler_DocumentCache_Disabled(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema:            &testutil.StarWarsSchema,
+		DocumentCacheSize: -1,
+	})
+
+	for i := 0; i < 2; i++ {
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name}}", nil))
+		if result.HasErrors() {
+			t.Fatalf("unexpected errors %v", result.Errors)
+		}
+	}
+
+	if stats := h.DocumentCacheStats(); stats != (handler.DocumentCacheStats{}) {
+		t.Fatalf("expected empty cache stats, got %+v", stats)
+	}
+}
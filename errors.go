@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"strings"
+)
+
+// Standard error codes, set in the extensions of the errors.
+const (
+	// CodeParseFailed is the code of the documents failing to parse.
+	CodeParseFailed = "GRAPHQL_PARSE_FAILED"
+
+	// CodeValidationFailed is the code of the documents failing to
+	// validate against the schema.
+	CodeValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+
+	// CodeBadUserInput is the code of the invalid variable values.
+	CodeBadUserInput = "BAD_USER_INPUT"
+
+	// CodeUnauthenticated is the code of the operations requiring an
+	// authenticated client.
+	CodeUnauthenticated = "UNAUTHENTICATED"
+
+	// CodeForbidden is the code of the operations the client is not
+	// allowed to perform.
+	CodeForbidden = "FORBIDDEN"
+
+	// CodeInternalServerError is the code of the unexpected errors masked
+	// by Config.MaskErrors.
+	CodeInternalServerError = "INTERNAL_SERVER_ERROR"
+)
+
+// Error codes of the requests and operations the handler rejects, set in the
+// extensions of the errors.
+const (
+	// CodeBadRequest is the code of the malformed requests.
+	CodeBadRequest = "BAD_REQUEST"
+
+	// CodeRequestTooLarge is the code of the request bodies exceeding
+	// Config.MaxBodyBytes.
+	CodeRequestTooLarge = "REQUEST_TOO_LARGE"
+
+	// CodeMethodNotAllowed is the code of the operations sent with an HTTP
+	// method that can't perform them.
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+
+	// CodeNotAcceptable is the code of the requests accepting no supported
+	// media type, with Config.GraphQLOverHTTP.
+	CodeNotAcceptable = "NOT_ACCEPTABLE"
+
+	// CodeQueryTooLarge is the code of the queries exceeding
+	// Config.MaxQueryLength, Config.MaxTokens, Config.MaxAliases or
+	// Config.MaxRootFields.
+	CodeQueryTooLarge = "QUERY_TOO_LARGE"
+
+	// CodeIntrospectionDisabled is the code of the introspection queries
+	// rejected by Config.DisableIntrospection.
+	CodeIntrospectionDisabled = "INTROSPECTION_DISABLED"
+
+	// CodeDepthLimitExceeded is the code of the operations exceeding
+	// Config.MaxDepth.
+	CodeDepthLimitExceeded = "DEPTH_LIMIT_EXCEEDED"
+
+	// CodeComplexityLimitExceeded is the code of the operations exceeding
+	// Config.MaxComplexity.
+	CodeComplexityLimitExceeded = "COMPLEXITY_LIMIT_EXCEEDED"
+
+	// CodeTooManyDeferredFragments is the code of the queries exceeding
+	// Config.MaxDeferredFragments.
+	CodeTooManyDeferredFragments = "TOO_MANY_DEFERRED_FRAGMENTS"
+
+	// CodeTooManyOperations is the code of the operations exceeding
+	// Config.MaxWebSocketOperations.
+	CodeTooManyOperations = "TOO_MANY_OPERATIONS"
+
+	// CodeTimeout is the code of the operations exceeding their timeout.
+	CodeTimeout = "TIMEOUT"
+
+	// CodeUploadTooLarge is the code of the uploaded files exceeding
+	// Config.MaxUploadSize.
+	CodeUploadTooLarge = "UPLOAD_TOO_LARGE"
+
+	// CodeTooManyUploads is the code of the requests exceeding
+	// Config.MaxUploadFiles.
+	CodeTooManyUploads = "TOO_MANY_UPLOADS"
+
+	// CodePersistedQueryNotFound, CodePersistedQueryNotSupported and
+	// CodePersistedQueryHashMismatch are the codes of the automatic persisted
+	// queries whose hash is unknown, whose version is not supported and whose
+	// hash does not match their query.
+	CodePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	CodePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+	CodePersistedQueryHashMismatch = "PERSISTED_QUERY_HASH_MISMATCH"
+
+	// CodePersistedOperationRequired, CodePersistedOperationNotFound and
+	// CodePersistedOperationMismatch are the codes of the requests sending a
+	// query with Config.PersistedOperationsOnly, referencing an unknown
+	// persisted operation, and sending a query that differs from it.
+	CodePersistedOperationRequired = "PERSISTED_OPERATION_REQUIRED"
+	CodePersistedOperationNotFound = "PERSISTED_OPERATION_NOT_FOUND"
+	CodePersistedOperationMismatch = "PERSISTED_OPERATION_MISMATCH"
+)
+
+// Error is an error carrying a code and extensions, which are sent to the
+// client in the extensions of the GraphQL error, e.g. when returned by a
+// resolver or a hook. Its message is shown to clients even when
+// Config.MaskErrors is enabled.
+type Error struct {
+	Code    string
+	Message string
+
+	// Fields are sent in the extensions of the error along with its code.
+	Fields map[string]interface{}
+
+	// Err is the error wrapped by the error, which is not shown to
+	// clients.
+	Err error
+}
+
+var (
+	_ gqlerrors.ExtendedError = &Error{}
+	_ SafeError               = &Error{}
+)
+
+// NewError returns an error with a code and a message.
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf returns an error with a code and a message formatted according to
+// format.
+func Errorf(code, format string, args ...interface{}) *Error {
+	return NewError(code, fmt.Sprintf(format, args...))
+}
+
+// WithField returns a copy of the error with an extension field.
+func (e *Error) WithField(key string, value interface{}) *Error {
+	fields := make(map[string]interface{}, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		fields[k] = v
+	}
+	fields[key] = value
+
+	err := *e
+	err.Fields = fields
+	return &err
+}
+
+// Wrap returns a copy of the error wrapping err.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Extensions returns the fields of the error along with its code.
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := make(map[string]interface{}, len(e.Fields)+1)
+	for key, value := range e.Fields {
+		extensions[key] = value
+	}
+	if e.Code != "" {
+		extensions["code"] = e.Code
+	}
+	return extensions
+}
+
+// Safe reports that the message of the error can be shown to clients.
+func (e *Error) Safe() bool {
+	return true
+}
+
+// errorExtensions returns the extensions of the first gqlerrors.ExtendedError
+// in the chain of err, if any.
+func errorExtensions(err error) map[string]interface{} {
+	var extended gqlerrors.ExtendedError
+	if err != nil && errors.As(err, &extended) {
+		return extended.Extensions()
+	}
+	return nil
+}
+
+// originalError returns the error a resolver returned, if any. Syntax,
+// validation and handler errors have none.
+func originalError(err gqlerrors.FormattedError) error {
+	original := err.OriginalError()
+	if located, ok := original.(*gqlerrors.Error); ok {
+		return located.OriginalError
+	}
+	return original
+}
+
+// newRequestErrorResult returns the result reporting a malformed request. The
+// error carries CodeBadRequest unless it is an *Error with its own code.
+func newRequestErrorResult(err error) *graphql.Result {
+	code := CodeBadRequest
+	var coded *Error
+	if errors.As(err, &coded) && coded.Code != "" {
+		code = coded.Code
+	}
+	return newErrorResult(err.Error(), code)
+}
+
+// setErrorCode sets the code of the errors that have none.
+func setErrorCode(errs []gqlerrors.FormattedError, code string) []gqlerrors.FormattedError {
+	for i := range errs {
+		if _, ok := errs[i].Extensions["code"]; ok {
+			continue
+		}
+		extensions := make(map[string]interface{}, len(errs[i].Extensions)+1)
+		for key, value := range errs[i].Extensions {
+			extensions[key] = value
+		}
+		extensions["code"] = code
+		errs[i].Extensions = extensions
+	}
+	return errs
+}
+
+// completeError sets the extensions of the errors wrapping an
+// gqlerrors.ExtendedError, and the code of the invalid variable values
+// reported by the executor.
+func completeError(err gqlerrors.FormattedError) gqlerrors.FormattedError {
+	if err.Extensions != nil {
+		return err
+	}
+
+	original := originalError(err)
+	if extensions := errorExtensions(original); extensions != nil {
+		err.Extensions = extensions
+	} else if isVariableError(err) {
+		err.Extensions = map[string]interface{}{"code": CodeBadUserInput}
+	}
+	return err
+}
+
+// isVariableError reports whether err is a variable value the executor failed
+// to coerce.
+func isVariableError(err gqlerrors.FormattedError) bool {
+	return originalError(err) == nil && strings.HasPrefix(err.Message, `Variable "$`)
+}
+
+// isRequestError reports whether result was not executed because of invalid
+// variable values, which is a request error.
+func isRequestError(result *graphql.Result) bool {
+	if result.Data != nil || len(result.Errors) == 0 {
+		return false
+	}
+	for _, err := range result.Errors {
+		if !isVariableError(err) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"testing"
+)
+
+func newCodedErrorSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"account": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, handler.NewError(handler.CodeForbidden, "Not allowed").WithField("scope", "accounts:read")
+					},
+				},
+				"wrapped": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						err := handler.Errorf(handler.CodeBadUserInput, "Invalid id %q", "x").Wrap(errors.New("strconv error"))
+						return nil, fmt.Errorf("loading account: %w", err)
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("cause")
+	err := handler.NewError(handler.CodeUnauthenticated, "Sign in").WithField("realm", "api").Wrap(cause)
+
+	if err.Error() != "Sign in" {
+		t.Fatalf("wrong message, got %q", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("expected the error to wrap its cause")
+	}
+	expected := map[string]interface{}{"code": handler.CodeUnauthenticated, "realm": "api"}
+	if !reflect.DeepEqual(err.Extensions(), expected) {
+		t.Fatalf("wrong extensions, expected %v, got %v", expected, err.Extensions())
+	}
+}
+
+func TestHandler_ErrorExtensions(t *testing.T) {
+	schema := newCodedErrorSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:     &schema,
+		MaskErrors: true,
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={account}", nil))
+	expected := map[string]interface{}{"code": handler.CodeForbidden, "scope": "accounts:read"}
+	if len(result.Errors) != 1 || result.Errors[0].Message != "Not allowed" || !reflect.DeepEqual(result.Errors[0].Extensions, expected) {
+		t.Fatalf("expected the error and its extensions, got %v", result.Errors)
+	}
+
+	result = executeTest(t, h, newHTTPCtx("GET", "/graphql?query={wrapped}", nil))
+	expected = map[string]interface{}{"code": handler.CodeBadUserInput}
+	if len(result.Errors) != 1 || !reflect.DeepEqual(result.Errors[0].Extensions, expected) {
+		t.Fatalf("expected the extensions of the wrapped error, got %v", result.Errors)
+	}
+}
+
+func TestHandler_ErrorCodes(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema: &testutil.StarWarsSchema,
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"parse", "/graphql?query={hero{", handler.CodeParseFailed},
+		{"validation", "/graphql?query={hero{unknown}}", handler.CodeValidationFailed},
+		{"variables", `/graphql?query=query($episode:Episode){hero(episode:$episode){name}}&variables={"episode":"NOPE"}`, handler.CodeBadUserInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := executeTest(t, h, newHTTPCtx("GET", tt.query, nil))
+			if len(result.Errors) == 0 {
+				t.Fatal("expected errors")
+			}
+			for _, err := range result.Errors {
+				if err.Extensions["code"] != tt.code {
+					t.Fatalf("wrong code, expected %s, got %v", tt.code, err.Extensions)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_HookErrorCode(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema: &testutil.StarWarsSchema,
+		OnRequest: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) error {
+			return fmt.Errorf("auth: %w", handler.NewError(handler.CodeUnauthenticated, "Sign in"))
+		},
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name}}", nil))
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != handler.CodeUnauthenticated {
+		t.Fatalf("expected the code of the wrapped error, got %v", result.Errors)
+	}
+}
@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/http"
+	"testing"
+)
+
+func newCounterSchema(t *testing.T, counter *int) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"counter": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return *counter, nil
+					},
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"increment": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						*counter++
+						return *counter, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_GETMutation(t *testing.T) {
+	cases := map[string]struct {
+		allowGETMutations  bool
+		method             string
+		url                string
+		expectedStatusCode int
+		expectedAllow      string
+		expectedCounter    int
+	}{
+		"rejects mutations over GET": {
+			method:             "GET",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedAllow:      "POST",
+		},
+		"selects the operation by name": {
+			method:             "GET",
+			url:                "/graphql?query=query A{counter} mutation B{increment}&operationName=B",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedAllow:      "POST",
+		},
+		"rejects mutations over HEAD": {
+			method:             "HEAD",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedAllow:      "POST",
+		},
+		"rejects mutations over DELETE": {
+			method:             "DELETE",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedAllow:      "POST",
+		},
+		"rejects mutations over DELETE when GET mutations are allowed": {
+			allowGETMutations:  true,
+			method:             "DELETE",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusMethodNotAllowed,
+			expectedAllow:      "POST",
+		},
+		"executes queries over GET": {
+			method:             "GET",
+			url:                "/graphql?query=query A{counter} mutation B{increment}&operationName=A",
+			expectedStatusCode: http.StatusOK,
+		},
+		"executes mutations over POST": {
+			method:             "POST",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusOK,
+			expectedCounter:    1,
+		},
+		"executes mutations over GET when allowed": {
+			allowGETMutations:  true,
+			method:             "GET",
+			url:                "/graphql?query=mutation{increment}",
+			expectedStatusCode: http.StatusOK,
+			expectedCounter:    1,
+		},
+	}
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			counter := 0
+			schema := newCounterSchema(t, &counter)
+			h := handler.New(&handler.Config{
+				Schema:            &schema,
+				AllowGETMutations: tc.allowGETMutations,
+			})
+
+			httpCtx := newHTTPCtx(tc.method, tc.url, nil)
+			result := executeTest(t, h, httpCtx)
+
+			if statusCode := httpCtx.Response.StatusCode(); statusCode != tc.expectedStatusCode {
+				t.Fatalf("wrong status code, expected %v, got %v", tc.expectedStatusCode, statusCode)
+			}
+			if allow := string(httpCtx.Response.Header.Peek("Allow")); allow != tc.expectedAllow {
+				t.Fatalf("wrong Allow header, expected %q, got %q", tc.expectedAllow, allow)
+			}
+			if tc.expectedStatusCode == http.StatusOK && result.HasErrors() {
+				t.Fatalf("unexpected errors %v", result.Errors)
+			}
+			if counter != tc.expectedCounter {
+				t.Fatalf("wrong counter, expected %v, got %v", tc.expectedCounter, counter)
+			}
+		})
+	}
+}
@@ -3,12 +3,20 @@ module github.com/nidrahou/graphql-fasthttp-handler
 go 1.18
 
 require (
+	github.com/fasthttp/websocket v1.5.1
 	github.com/graphql-go/graphql v0.8.0
 	github.com/valyala/fasthttp v1.44.0
+	go.opentelemetry.io/otel v1.14.0
+	go.opentelemetry.io/otel/sdk v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
 )
 
 require (
 	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/savsgio/gotils v0.0.0-20220530130905-52f3993e8d6d // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
 )
@@ -18,7 +18,7 @@ type graphiqlData struct {
 }
 
 // renderGraphiQL renders the GraphiQL GUI
-func renderGraphiQL(ctx *fasthttp.RequestCtx, params graphql.Params) {
+func renderGraphiQL(ctx *fasthttp.RequestCtx, opts *RequestOptions, result *graphql.Result) {
 	t := template.New("GraphiQL")
 	t, err := t.Parse(graphiqlTemplate)
 	if err != nil {
@@ -27,7 +27,7 @@ func renderGraphiQL(ctx *fasthttp.RequestCtx, params graphql.Params) {
 	}
 
 	// Create variables string
-	vars, err := json.MarshalIndent(params.VariableValues, "", "  ")
+	vars, err := json.MarshalIndent(opts.Variables, "", "  ")
 	if err != nil {
 		httpError(ctx, err.Error(), http.StatusInternalServerError)
 		return
@@ -39,10 +39,10 @@ func renderGraphiQL(ctx *fasthttp.RequestCtx, params graphql.Params) {
 
 	// Create result string
 	var resString string
-	if params.RequestString == "" {
+	if opts.Query == "" {
 		resString = ""
 	} else {
-		result, err := json.MarshalIndent(graphql.Do(params), "", "  ")
+		result, err := json.MarshalIndent(result, "", "  ")
 		if err != nil {
 			httpError(ctx, err.Error(), http.StatusInternalServerError)
 			return
@@ -52,10 +52,10 @@ func renderGraphiQL(ctx *fasthttp.RequestCtx, params graphql.Params) {
 
 	d := graphiqlData{
 		GraphiqlVersion: graphiqlVersion,
-		QueryString:     params.RequestString,
+		QueryString:     opts.Query,
 		ResultString:    resString,
 		VariablesString: varsString,
-		OperationName:   params.OperationName,
+		OperationName:   opts.OperationName,
 	}
 	err = t.ExecuteTemplate(ctx, "index", d)
 	if err != nil {
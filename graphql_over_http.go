@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// requestErrorResult is the response to a request that failed before
+// execution, which must not carry a data entry.
+type requestErrorResult struct {
+	Errors     []gqlerrors.FormattedError `json:"errors"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+}
+
+// checkGraphQLOverHTTP rejects the requests the GraphQL-over-HTTP
+// specification does not allow. It returns a non-nil result, along with the
+// HTTP status code it should be answered with, when the request is rejected.
+func (h *Handler) checkGraphQLOverHTTP(ctxreq *fasthttp.RequestCtx) (*graphql.Result, int) {
+	if !ctxreq.IsGet() && !ctxreq.IsPost() {
+		ctxreq.Response.Header.Set("Allow", "GET, POST")
+		return newErrorResult("GraphQL only supports GET and POST requests", CodeMethodNotAllowed), http.StatusMethodNotAllowed
+	}
+
+	if negotiateMediaType(string(ctxreq.Request.Header.Peek("Accept"))) == "" &&
+		!acceptsEventStream(ctxreq) && !acceptsIncrementalDelivery(ctxreq) &&
+		!((h.graphiql || h.playground) && wantsHTML(ctxreq)) {
+		return newErrorResult("Unsupported Accept header", CodeNotAcceptable), http.StatusNotAcceptable
+	}
+
+	return nil, http.StatusOK
+}
+
+// requestErrorStatus returns the status code of responses to requests that
+// failed before execution.
+func (h *Handler) requestErrorStatus() int {
+	if h.graphqlOverHTTP {
+		return http.StatusBadRequest
+	}
+	return http.StatusOK
+}
+
+// responseContentType returns the media type of the JSON responses.
+func (h *Handler) responseContentType(ctxreq *fasthttp.RequestCtx) string {
+	if h.graphqlOverHTTP {
+		if mediaType := negotiateMediaType(string(ctxreq.Request.Header.Peek("Accept"))); mediaType != "" {
+			return mediaType
+		}
+	}
+	return ContentTypeJSON
+}
+
+// negotiateMediaType returns the supported media type the Accept header
+// prefers, or an empty string when it accepts none of them. Requests without
+// an Accept header are answered with application/json.
+func negotiateMediaType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypeJSON
+	}
+
+	best, bestQuality := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				quality, _ = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			}
+		}
+
+		var mediaType string
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case ContentTypeGraphQLResponse:
+			mediaType = ContentTypeGraphQLResponse
+		case ContentTypeJSON, "application/*", "*/*":
+			mediaType = ContentTypeJSON
+		}
+		if mediaType != "" && quality > bestQuality {
+			best, bestQuality = mediaType, quality
+		}
+	}
+	return best
+}
+
+// acceptedMediaRange returns the parameters of the media range of the Accept
+// header matching mediaType, reporting whether one accepts it. Wildcards are
+// not matched.
+func acceptedMediaRange(accept string, mediaType string) (map[string]string, bool) {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		if strings.ToLower(strings.TrimSpace(params[0])) != mediaType {
+			continue
+		}
+
+		values := map[string]string{}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 {
+				values[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+		}
+		if q, ok := values["q"]; ok {
+			if quality, _ := strconv.ParseFloat(q, 64); quality <= 0 {
+				return nil, false
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
@@ -0,0 +1,173 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandler_GraphQLOverHTTP(t *testing.T) {
+	cases := map[string]struct {
+		graphqlOverHTTP     bool
+		method              string
+		url                 string
+		contentType         string
+		body                string
+		accept              string
+		expectedStatusCode  int
+		expectedContentType string
+		expectedAllow       string
+		expectedCode        string
+		expectsData         bool
+	}{
+		"executes a valid query": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={hero{name}}",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+			expectsData:         true,
+		},
+		"answers with application/graphql-response+json when accepted": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={hero{name}}",
+			accept:              "application/json;q=0.9, application/graphql-response+json",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/graphql-response+json; charset=utf-8",
+			expectsData:         true,
+		},
+		"rejects unsupported methods": {
+			graphqlOverHTTP:     true,
+			method:              "PUT",
+			url:                 "/graphql?query={hero{name}}",
+			expectedStatusCode:  http.StatusMethodNotAllowed,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedAllow:       "GET, POST",
+			expectedCode:        handler.CodeMethodNotAllowed,
+		},
+		"rejects unsupported Accept headers": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={hero{name}}",
+			accept:              "text/plain",
+			expectedStatusCode:  http.StatusNotAcceptable,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedCode:        handler.CodeNotAcceptable,
+		},
+		"rejects malformed JSON": {
+			graphqlOverHTTP:     true,
+			method:              "POST",
+			url:                 "/graphql",
+			contentType:         "application/json",
+			body:                `{"query": `,
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedCode:        handler.CodeBadRequest,
+		},
+		"rejects malformed variables": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={hero{name}}&variables={",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedCode:        handler.CodeBadUserInput,
+		},
+		"rejects malformed variables in the body": {
+			graphqlOverHTTP:     true,
+			method:              "POST",
+			url:                 "/graphql",
+			contentType:         "application/json",
+			body:                `{"query": "{hero{name}}", "variables": "{"}`,
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+			expectedCode:        handler.CodeBadUserInput,
+		},
+		"rejects documents failing to parse": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={hero{name}",
+			accept:              "application/graphql-response+json",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/graphql-response+json; charset=utf-8",
+		},
+		"rejects documents failing to validate": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query={unknownField}",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		"rejects variables failing to coerce": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 "/graphql?query=query($id:String!){human(id:$id){name}}",
+			accept:              "application/graphql-response+json",
+			expectedStatusCode:  http.StatusBadRequest,
+			expectedContentType: "application/graphql-response+json; charset=utf-8",
+		},
+		"executes queries with valid variables": {
+			graphqlOverHTTP:     true,
+			method:              "GET",
+			url:                 `/graphql?query=query($id:String!){human(id:$id){name}}&variables={"id":"1000"}`,
+			accept:              "application/graphql-response+json",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/graphql-response+json; charset=utf-8",
+			expectsData:         true,
+		},
+		"keeps answering 200 to variables failing to coerce when disabled": {
+			method:              "GET",
+			url:                 "/graphql?query=query($id:String!){human(id:$id){name}}",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+			expectsData:         true,
+		},
+		"keeps answering 200 when disabled": {
+			method:              "GET",
+			url:                 "/graphql?query={unknownField}",
+			expectedStatusCode:  http.StatusOK,
+			expectedContentType: "application/json; charset=utf-8",
+			expectsData:         true,
+		},
+	}
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			var body []byte
+			if tc.body != "" {
+				body = []byte(tc.body)
+			}
+			httpCtx := newHTTPCtx(tc.method, tc.url, body)
+			if tc.contentType != "" {
+				httpCtx.Request.Header.SetContentType(tc.contentType)
+			}
+			if tc.accept != "" {
+				httpCtx.Request.Header.Set("Accept", tc.accept)
+			}
+
+			h := handler.New(&handler.Config{
+				Schema:          &testutil.StarWarsSchema,
+				GraphQLOverHTTP: tc.graphqlOverHTTP,
+			})
+			h.ServeHTTP(httpCtx)
+
+			if statusCode := httpCtx.Response.StatusCode(); statusCode != tc.expectedStatusCode {
+				t.Fatalf("wrong status code, expected %v, got %v: %s", tc.expectedStatusCode, statusCode, httpCtx.Response.Body())
+			}
+			if contentType := string(httpCtx.Response.Header.ContentType()); contentType != tc.expectedContentType {
+				t.Fatalf("wrong content type, expected %s, got %s", tc.expectedContentType, contentType)
+			}
+			if allow := string(httpCtx.Response.Header.Peek("Allow")); allow != tc.expectedAllow {
+				t.Fatalf("wrong Allow header, expected %q, got %q", tc.expectedAllow, allow)
+			}
+			if code := `"code":"` + tc.expectedCode + `"`; tc.expectedCode != "" && !strings.Contains(string(httpCtx.Response.Body()), code) {
+				t.Fatalf("wrong error code, expected %s: %s", tc.expectedCode, httpCtx.Response.Body())
+			}
+			if hasData := strings.Contains(string(httpCtx.Response.Body()), `"data"`); hasData != tc.expectsData {
+				t.Fatalf("wrong data entry presence, expected %v: %s", tc.expectsData, httpCtx.Response.Body())
+			}
+		})
+	}
+}
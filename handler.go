@@ -3,17 +3,25 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/fasthttp/websocket"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	ContentTypeHTML           = "text/html"
-	ContentTypeJSON           = "application/json"
-	ContentTypeGraphQL        = "application/graphql"
-	ContentTypeFormURLEncoded = "application/x-www-form-urlencoded"
+	ContentTypeHTML            = "text/html"
+	ContentTypeJSON            = "application/json"
+	ContentTypeGraphQLResponse = "application/graphql-response+json"
+	ContentTypeGraphQL         = "application/graphql"
+	ContentTypeFormURLEncoded  = "application/x-www-form-urlencoded"
 )
 
 type Handler struct {
@@ -22,12 +30,86 @@ type Handler struct {
 	graphiql     bool
 	playground   bool
 	rootObjectFn RootObjectFn
+	contextFn    ContextFn
+	middlewares  []Middleware
+
+	onRequest   RequestHook
+	onParsed    DocumentHook
+	onValidated DocumentHook
+	onExecuted  ResultHook
+	onResult    ResultHook
+
+	batchConcurrency    int
+	persistedQueryStore PersistedQueryStore
+
+	maxDeferredFragments int
+	deferConcurrency     int
+
+	persistedOperations     map[string]string
+	persistedOperationsOnly bool
+
+	documentCache *documentCache
+
+	graphqlOverHTTP   bool
+	allowGETMutations bool
+
+	maxDepth         int
+	maxComplexity    int
+	fieldCosts       map[string]FieldCost
+	reportComplexity bool
+
+	disableIntrospection bool
+	introspectionFn      IntrospectionFn
+
+	maxBodyBytes   int
+	maxQueryLength int
+	maxTokens      int
+	maxAliases     int
+	maxRootFields  int
+
+	connectionInitFn       ConnectionInitFn
+	connectionInitTimeout  time.Duration
+	keepAliveInterval      time.Duration
+	maxWebSocketOperations int
+	sseHeartbeatInterval   time.Duration
+	webSocketCheckOrigin   func(ctx *fasthttp.RequestCtx) bool
+
+	maxUploadSize  int64
+	maxUploadFiles int
+
+	timeout       time.Duration
+	timeoutFn     TimeoutFn
+	timeoutStatus int
+
+	// shutdownWatchers holds the *shutdownWatcher of each server, keyed by
+	// the channel closed on its shutdown.
+	shutdownWatchers sync.Map
+
+	// executionSchema is the schema instrumented with the extensions of the
+	// handler, or nil when none is needed.
+	executionSchema *graphql.Schema
+	tracing         bool
+	tracer          oteltrace.Tracer
+	propagator      propagation.TextMapPropagator
+
+	metrics MetricsCollector
+
+	logger                 Logger
+	redactedVariables      []string
+	slowOperationThreshold time.Duration
+
+	maskErrors     bool
+	errorFormatter ErrorFormatter
+	errorReporter  ErrorReporter
 }
 
 type RequestOptions struct {
 	Query         string                 `json:"query" url:"query" schema:"query"`
 	Variables     map[string]interface{} `json:"variables" url:"variables" schema:"variables"`
 	OperationName string                 `json:"operationName" url:"operationName" schema:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions" url:"extensions" schema:"extensions"`
+	ID            string                 `json:"id" url:"id" schema:"id"`
+	DocumentID    string                 `json:"documentId" url:"documentId" schema:"documentId"`
 }
 
 // a workaround for getting`variables` as a JSON string
@@ -37,16 +119,28 @@ type requestOptionsCompatibility struct {
 	OperationName string `json:"operationName" url:"operationName" schema:"operationName"`
 }
 
-func getFromArgs(values *fasthttp.Args) *RequestOptions {
+func getFromArgs(values *fasthttp.Args) (*RequestOptions, error) {
 	query := values.Peek("query")
-	if query != nil {
+	extensionsStr := values.Peek("extensions")
+	id := values.Peek("id")
+	documentID := values.Peek("documentId")
+	if query != nil || extensionsStr != nil || id != nil || documentID != nil {
 		// get variables map
 		variables := make(map[string]interface{}, values.Len())
 		variablesStr := values.Peek("variables")
 		if variablesStr != nil {
 			err := json.Unmarshal(variablesStr, &variables)
 			if err != nil {
-				return nil
+				return nil, Errorf(CodeBadUserInput, "variables are invalid JSON: %v", err)
+			}
+		}
+
+		// get extensions map
+		var extensions map[string]interface{}
+		if extensionsStr != nil {
+			err := json.Unmarshal(extensionsStr, &extensions)
+			if err != nil {
+				return nil, fmt.Errorf("extensions are invalid JSON: %v", err)
 			}
 		}
 
@@ -54,21 +148,39 @@ func getFromArgs(values *fasthttp.Args) *RequestOptions {
 			Query:         string(query),
 			Variables:     variables,
 			OperationName: string(values.Peek("operationName")),
-		}
+			Extensions:    extensions,
+			ID:            string(id),
+			DocumentID:    string(documentID),
+		}, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 // RequestOptions Parses a http.Request into GraphQL request options struct
 func NewRequestOptions(ctx *fasthttp.RequestCtx) *RequestOptions {
+	opts, _ := ParseRequestOptions(ctx)
+	return opts
+}
 
-	if reqOpt := getFromArgs(ctx.URI().QueryArgs()); reqOpt != nil {
-		return reqOpt
+// ParseRequestOptions parses a http.Request into GraphQL request options
+// struct like NewRequestOptions does, but also reports malformed parameters.
+// Malformed variables are reported as an *Error with CodeBadUserInput.
+// The returned options are never nil, even when an error is reported.
+func ParseRequestOptions(ctx *fasthttp.RequestCtx) (*RequestOptions, error) {
+	// POST requests carry their operation in the body, unless the URL holds
+	// a query, so other parameters of their URL are not mistaken for one
+	var argsErr error
+	if args := ctx.URI().QueryArgs(); !ctx.Request.Header.IsPost() || args.Has("query") {
+		reqOpt, err := getFromArgs(args)
+		if reqOpt != nil {
+			return reqOpt, nil
+		}
+		argsErr = err
 	}
 
 	if !ctx.Request.Header.IsPost() || len(ctx.Request.Body()) == 0 {
-		return &RequestOptions{}
+		return &RequestOptions{}, argsErr
 	}
 
 	// TODO: improve Content-Type handling
@@ -81,82 +193,215 @@ func NewRequestOptions(ctx *fasthttp.RequestCtx) *RequestOptions {
 		body := ctx.Request.Body()
 		return &RequestOptions{
 			Query: string(body),
-		}
+		}, nil
 	case ContentTypeFormURLEncoded:
 		args := ctx.PostArgs()
 		if args == nil {
-			return &RequestOptions{}
+			return &RequestOptions{}, nil
 		}
 
-		if reqOpt := getFromArgs(args); reqOpt != nil {
-			return reqOpt
+		reqOpt, err := getFromArgs(args)
+		if reqOpt != nil {
+			return reqOpt, nil
 		}
 
-		return &RequestOptions{}
+		return &RequestOptions{}, err
+
+	case ContentTypeMultipartFormData:
+		list, batch, err := parseMultipartRequest(ctx)
+		if err != nil {
+			return &RequestOptions{}, err
+		}
+		if batch {
+			return &RequestOptions{}, fmt.Errorf("operations field holds a batch of operations")
+		}
+		return list[0], nil
 
 	case ContentTypeJSON:
 		fallthrough
 	default:
-		var opts RequestOptions
-		body := ctx.Request.Body()
-		err := json.Unmarshal(body, &opts)
-		if err != nil {
-			// Probably `variables` was sent as a string instead of an object.
-			// So, we try to be polite and try to parse that as a JSON string
-			var optsCompatible requestOptionsCompatibility
-			json.Unmarshal(body, &optsCompatible)
-			json.Unmarshal([]byte(optsCompatible.Variables), &opts.Variables)
+		return newRequestOptionsFromJSON(ctx.Request.Body())
+	}
+}
+
+// newRequestOptionsFromJSON parses a single JSON encoded operation.
+func newRequestOptionsFromJSON(body []byte) (*RequestOptions, error) {
+	var opts RequestOptions
+	err := json.Unmarshal(body, &opts)
+	if err != nil {
+		// Probably `variables` was sent as a string instead of an object.
+		// So, we try to be polite and try to parse that as a JSON string
+		var optsCompatible requestOptionsCompatibility
+		if err := json.Unmarshal(body, &optsCompatible); err != nil {
+			return &opts, fmt.Errorf("malformed request body: %v", err)
+		}
+		if err := json.Unmarshal([]byte(optsCompatible.Variables), &opts.Variables); err != nil {
+			return &opts, Errorf(CodeBadUserInput, "variables are invalid JSON: %v", err)
 		}
-		return &opts
 	}
+	return &opts, nil
 }
 
 // ContextHandler provides an entrypoint into executing graphQL queries with a
 // user-provided context.
 func (h *Handler) ContextHandler(ctx context.Context, ctxreq *fasthttp.RequestCtx) {
-	// get query
-	opts := NewRequestOptions(ctxreq)
+	start := time.Now()
+	ctx = h.requestContext(ctx, ctxreq)
 
-	// execute graphql query
-	params := graphql.Params{
-		Schema:         *h.Schema,
-		RequestString:  opts.Query,
-		VariableValues: opts.Variables,
-		OperationName:  opts.OperationName,
-		Context:        ctx,
-	}
-	if h.rootObjectFn != nil {
-		params.RootObject = h.rootObjectFn(ctx, &ctxreq.Request)
-	}
-	result := graphql.Do(params)
-
-	if h.graphiql {
-		acceptHeader := string(ctxreq.Request.Header.Peek("Accept"))
-		if !ctxreq.Request.URI().QueryArgs().Has("raw") && !strings.Contains(acceptHeader, ContentTypeJSON) && strings.Contains(acceptHeader, ContentTypeHTML) {
-			renderGraphiQL(ctxreq, params)
+	ctx, span := h.startRequestSpan(ctx, ctxreq)
+	defer endRequestSpan(span, ctxreq)
+
+	// subscriptions are served over WebSocket connections
+	if websocket.FastHTTPIsWebSocketUpgrade(ctxreq) {
+		h.serveWebSocket(ctx, ctxreq)
+		return
+	}
+
+	if h.graphqlOverHTTP {
+		if result, status := h.checkGraphQLOverHTTP(ctxreq); result != nil {
+			h.rejectRequest(ctx, ctxreq, start, result, status)
 			return
 		}
 	}
 
-	if h.playground {
-		acceptHeader := string(ctxreq.Request.Header.Peek("Accept"))
-		if !ctxreq.Request.URI().QueryArgs().Has("raw") && !strings.Contains(acceptHeader, ContentTypeJSON) && strings.Contains(acceptHeader, ContentTypeHTML) {
-			renderPlayground(ctxreq)
-			return
+	// reject oversized bodies before parsing them
+	if h.maxBodyBytes > 0 && len(ctxreq.Request.Body()) > h.maxBodyBytes {
+		message := fmt.Sprintf("Request body exceeds the maximum of %d bytes", h.maxBodyBytes)
+		h.rejectRequest(ctx, ctxreq, start, newErrorResult(message, CodeRequestTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if result := h.checkUploadLimits(ctxreq); result != nil {
+		h.rejectRequest(ctx, ctxreq, start, result, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// batched operations are answered with an array of results
+	if batch, errs := parseBatchRequestOptions(ctxreq); batch != nil {
+		h.writeJSON(ctxreq, h.executeBatch(ctx, ctxreq, batch, errs), http.StatusOK)
+		return
+	}
+
+	// get query
+	opts, err := ParseRequestOptions(ctxreq)
+
+	// operations may be streamed as Server-Sent Events
+	if err == nil && acceptsEventStream(ctxreq) {
+		h.serveEventStream(ctx, ctxreq, opts)
+		return
+	}
+
+	// deferred and streamed results are delivered incrementally
+	if err == nil && acceptsIncrementalDelivery(ctxreq) {
+		h.serveIncremental(ctx, ctxreq, opts)
+		return
+	}
+
+	// execute graphql query
+	var result *graphql.Result
+	var status int
+	if err != nil && h.graphqlOverHTTP {
+		result, status = h.formatErrors(ctx, newRequestErrorResult(err)), http.StatusBadRequest
+		h.reportRejection(opts, nil, start, result, status)
+	} else {
+		result, status = h.execute(ctx, ctxreq, opts)
+	}
+	result = h.runResultHook(ctx, ctxreq, opts, result)
+
+	if h.graphiql && wantsHTML(ctxreq) {
+		renderGraphiQL(ctxreq, opts, result)
+		return
+	}
+
+	if h.playground && wantsHTML(ctxreq) {
+		renderPlayground(ctxreq)
+		return
+	}
+
+	h.writeJSON(ctxreq, result, status)
+}
+
+// rejectRequest answers a request rejected before its operations are parsed,
+// reporting it along with the operations.
+func (h *Handler) rejectRequest(ctx context.Context, ctxreq *fasthttp.RequestCtx, start time.Time, result *graphql.Result, status int) {
+	h.formatErrors(ctx, result)
+	h.reportRejection(nil, nil, start, result, status)
+	h.writeJSON(ctxreq, result, status)
+}
+
+// wantsHTML reports whether the request was made by a browser expecting one
+// of the GraphQL IDEs rather than a JSON response.
+func wantsHTML(ctxreq *fasthttp.RequestCtx) bool {
+	acceptHeader := string(ctxreq.Request.Header.Peek("Accept"))
+	return !ctxreq.Request.URI().QueryArgs().Has("raw") && !strings.Contains(acceptHeader, ContentTypeJSON) && strings.Contains(acceptHeader, ContentTypeHTML)
+}
+
+// execute runs a single operation, bound to its timeout, and returns its
+// result along with the HTTP status code it should be answered with.
+func (h *Handler) execute(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) (*graphql.Result, int) {
+	ctx, cancel := h.operationContext(ctx, ctxreq, h.operationTimeout(ctxreq, opts))
+	defer cancel()
+
+	result, status := h.executeWithMiddlewares(ctx, ctxreq, opts)
+	if ctx.Err() == context.DeadlineExceeded {
+		return h.formatErrors(ctx, newTimeoutResult()), h.timeoutStatus
+	}
+	return result, status
+}
+
+// executeRequest runs a single operation and returns its result along with
+// the HTTP status code it should be answered with.
+func (h *Handler) executeRequest(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) (*graphql.Result, int) {
+	op, result, status := h.prepareOperation(ctx, ctxreq, opts)
+	if result != nil {
+		return result, status
+	}
+
+	if result, status := h.checkGETOperation(ctx, ctxreq, op); result != nil {
+		return result, status
+	}
+
+	result = h.executeOperation(ctx, ctxreq, op)
+	return result, op.status
+}
+
+// checkGETOperation rejects the operations a GET request, or any other
+// request than a POST one, may not perform. Only queries, and the given
+// operation types, may be triggered by a link or an image tag.
+func (h *Handler) checkGETOperation(ctx context.Context, ctxreq *fasthttp.RequestCtx, op *operation, allowed ...string) (*graphql.Result, int) {
+	if ctxreq.IsPost() || (ctxreq.IsGet() && h.allowGETMutations) || op.definition == nil || op.definition.Operation == ast.OperationTypeQuery {
+		return nil, http.StatusOK
+	}
+	for _, operationType := range allowed {
+		if op.definition.Operation == operationType {
+			return nil, http.StatusOK
 		}
 	}
 
+	ctxreq.Response.Header.Set("Allow", "POST")
+	message := fmt.Sprintf("Can only perform a %s operation from a POST request", op.definition.Operation)
+	result := h.formatErrors(ctx, newErrorResult(message, CodeMethodNotAllowed))
+	h.reportRejection(op.opts, op.definition, op.start, result, http.StatusMethodNotAllowed)
+	return result, http.StatusMethodNotAllowed
+}
+
+// writeJSON serializes v as the JSON response body. Results of requests that
+// failed before execution are written without a data entry.
+func (h *Handler) writeJSON(ctxreq *fasthttp.RequestCtx, v interface{}, status int) {
 	// use proper JSON Header
-	ctxreq.Response.Header.SetContentType("application/json; charset=utf-8")
+	ctxreq.Response.Header.SetContentType(h.responseContentType(ctxreq) + "; charset=utf-8")
+
+	if result, ok := v.(*graphql.Result); ok && status >= http.StatusBadRequest {
+		v = requestErrorResult{Errors: result.Errors, Extensions: result.Extensions}
+	}
 
 	if h.pretty {
-		ctxreq.Response.SetStatusCode(http.StatusOK)
-		buff, _ := json.MarshalIndent(result, "", "\t")
+		ctxreq.Response.SetStatusCode(status)
+		buff, _ := json.MarshalIndent(v, "", "\t")
 
 		ctxreq.Response.AppendBody(buff)
 	} else {
-		ctxreq.Response.SetStatusCode(http.StatusOK)
-		buff, _ := json.Marshal(result)
+		ctxreq.Response.SetStatusCode(status)
+		buff, _ := json.Marshal(v)
 
 		ctxreq.Response.AppendBody(buff)
 	}
@@ -176,6 +421,207 @@ type Config struct {
 	GraphiQL     bool
 	Playground   bool
 	RootObjectFn RootObjectFn
+
+	// ContextFn builds the context of every request from the context given to
+	// ContextHandler, which is context.Background() with ServeHTTP. The
+	// request can also be retrieved from within resolvers with
+	// RequestCtxFromContext.
+	ContextFn ContextFn
+
+	// Middlewares wrap the execution of every operation, batched and
+	// streamed operations included, the first middleware being the
+	// outermost one. With BatchConcurrency, the middlewares of a batch run in
+	// parallel on the same *fasthttp.RequestCtx, so they must not modify it
+	// without synchronization.
+	Middlewares []Middleware
+
+	// OnRequest, OnParsed, OnValidated and OnExecuted are called for every
+	// operation once its options are parsed from the request, once its
+	// document is parsed, once it is validated, and once it is executed.
+	// Cached documents are passed to OnParsed and OnValidated without being
+	// parsed again, so those hooks must not modify them. OnExecuted is not called for the results of
+	// subscriptions and of deferred fragments. The operations of a batch or
+	// of a WebSocket connection share their *fasthttp.RequestCtx, so their
+	// hooks are called one at a time even when the operations run in
+	// parallel.
+	OnRequest   RequestHook
+	OnParsed    DocumentHook
+	OnValidated DocumentHook
+	OnExecuted  ResultHook
+
+	// OnResult is called right before the result of an operation is
+	// serialized as a JSON response, rejected operations included. Streamed
+	// results are not passed to it.
+	OnResult ResultHook
+
+	// BatchConcurrency caps how many operations of a batched request are
+	// executed in parallel. Values lower than 2 execute them sequentially.
+	BatchConcurrency int
+
+	// MaxDeferredFragments rejects queries delivered incrementally with more
+	// deferred fragments than this, since each of them resolves the fields
+	// leading to it again. It defaults to
+	// DefaultMaxDeferredFragments, a negative value disables it.
+	// DeferConcurrency caps how many deferred fragments of a query are
+	// executed in parallel. It defaults to DefaultDeferConcurrency.
+	MaxDeferredFragments int
+	DeferConcurrency     int
+
+	// PersistedQueryStore holds the documents registered through automatic
+	// persisted queries. It defaults to an in-memory LRU store.
+	PersistedQueryStore PersistedQueryStore
+
+	// PersistedOperations maps operation ids to their documents. Requests may
+	// reference them through the `id` or `documentId` parameters.
+	PersistedOperations map[string]string
+
+	// PersistedOperationsFile is the path of a JSON manifest mapping operation
+	// ids to documents. It is loaded by New and merged into
+	// PersistedOperations.
+	PersistedOperationsFile string
+
+	// PersistedOperationsOnly rejects every request that does not reference a
+	// persisted operation, locking the endpoint to the known operations.
+	PersistedOperationsOnly bool
+
+	// DocumentCacheSize bounds the cache of parsed and validated documents.
+	// It defaults to DefaultDocumentCacheSize, a negative size disables it.
+	DocumentCacheSize int
+
+	// GraphQLOverHTTP enables the status codes and media types of the
+	// GraphQL-over-HTTP specification: 405 for methods other than GET and POST,
+	// 406 for unsupported Accept headers, 400 for malformed requests,
+	// documents failing to parse or validate and variables failing to
+	// coerce, and application/graphql-response+json responses for the
+	// clients accepting them. It is disabled by default for backwards
+	// compatibility, answering every request with a 200 status code.
+	GraphQLOverHTTP bool
+
+	// AllowGETMutations keeps the legacy behavior of executing mutations and
+	// subscriptions sent through GET requests. By default they are rejected
+	// with a 405 status code, so they cannot be triggered by a link, as are
+	// the ones sent through any other method than GET and POST.
+	AllowGETMutations bool
+
+	// MaxDepth rejects operations nesting fields deeper than this many levels,
+	// following fragments, before any resolver is invoked. Zero disables it.
+	MaxDepth int
+
+	// MaxComplexity rejects operations whose cost, computed from the document
+	// and the variables, exceeds this budget. Zero disables it.
+	MaxComplexity int
+
+	// FieldCosts holds the cost hints of fields, keyed by "Type.field".
+	FieldCosts map[string]FieldCost
+
+	// ReportComplexity adds the computed cost of each operation to the
+	// `extensions.complexity` entry of its result.
+	ReportComplexity bool
+
+	// DisableIntrospection rejects operations selecting the `__schema` or
+	// `__type` introspection fields, unless IntrospectionFn allows them for
+	// the request. GraphiQL and Playground rely on introspection.
+	DisableIntrospection bool
+	IntrospectionFn      IntrospectionFn
+
+	// MaxBodyBytes rejects request bodies larger than this many bytes with a
+	// 413 status code, and closes WebSocket connections receiving larger
+	// messages. Zero disables it.
+	MaxBodyBytes int
+
+	// MaxQueryLength, MaxTokens, MaxAliases and MaxRootFields reject, with a
+	// 400 status code, queries longer than this many characters or holding
+	// more than this many lexical tokens, aliased fields or root fields. The
+	// length and token limits are enforced before the query is parsed, the
+	// alias and root field limits before it is validated. Zero disables a
+	// limit.
+	MaxQueryLength int
+	MaxTokens      int
+	MaxAliases     int
+	MaxRootFields  int
+
+	// ConnectionInitFn is called when a WebSocket client initialises its
+	// connection, e.g. to authenticate it from the connection_init payload.
+	ConnectionInitFn ConnectionInitFn
+
+	// ConnectionInitTimeout is how long a WebSocket client has to initialise
+	// its connection. It defaults to DefaultConnectionInitTimeout.
+	ConnectionInitTimeout time.Duration
+
+	// KeepAliveInterval is how often acknowledged WebSocket connections are
+	// sent a keep-alive message: ping with graphql-transport-ws, ka with the
+	// legacy graphql-ws protocol. Zero disables keep-alive messages.
+	KeepAliveInterval time.Duration
+
+	// MaxWebSocketOperations caps how many operations run at once on a
+	// WebSocket connection, further ones being rejected with an error. It
+	// defaults to DefaultMaxWebSocketOperations, a negative value disables
+	// it.
+	MaxWebSocketOperations int
+
+	// SSEHeartbeatInterval is how often Server-Sent Events streams are sent a
+	// heartbeat comment. It defaults to DefaultSSEHeartbeatInterval, a
+	// negative interval disables heartbeats.
+	SSEHeartbeatInterval time.Duration
+
+	// WebSocketCheckOrigin decides whether to accept a WebSocket upgrade
+	// request. By default only same origin requests are accepted.
+	WebSocketCheckOrigin func(ctx *fasthttp.RequestCtx) bool
+
+	// MaxUploadSize and MaxUploadFiles reject, with a 413 status code,
+	// multipart requests holding a file larger than this many bytes or more
+	// than this many files. Zero disables a limit.
+	MaxUploadSize  int64
+	MaxUploadFiles int
+
+	// Timeout bounds the execution of queries and mutations: their context
+	// gets a deadline, and the operations exceeding it are answered with a
+	// TIMEOUT error and the TimeoutStatus status code, which defaults to
+	// DefaultTimeoutStatus. TimeoutFn, when set, returns the timeout of each
+	// operation instead. Zero disables the timeout. The context of every
+	// operation is also cancelled when the server shuts down.
+	Timeout       time.Duration
+	TimeoutFn     TimeoutFn
+	TimeoutStatus int
+
+	// Tracing instruments the execution of operations and reports their
+	// parsing, validation and resolver timings in the extensions.tracing
+	// entry of each result, following the Apollo tracing format.
+	Tracing bool
+
+	// TracerProvider enables OpenTelemetry: a span is started for each
+	// request, as a child of the W3C trace context of its headers, with
+	// child spans for the parsing, validation and execution of its
+	// operations. Propagator overrides the propagation of the parent span
+	// context, and ResolverSpans also starts a span for each resolved field.
+	TracerProvider oteltrace.TracerProvider
+	Propagator     propagation.TextMapPropagator
+	ResolverSpans  bool
+
+	// Metrics records the count, duration and errors of the operations, and
+	// the documents failing to parse or validate. NewMetrics returns a
+	// collector that Handler.ServeMetrics exposes to Prometheus.
+	Metrics MetricsCollector
+
+	// Logger logs the name, document hash, variables, duration, status and
+	// error count of each operation. The values of the variables and input
+	// fields whose name contains one of RedactedVariables, regardless of
+	// case, are redacted; it defaults to DefaultRedactedVariables. Operations
+	// taking longer than SlowOperationThreshold are also logged as warnings
+	// along with their document and the timings of their phases.
+	Logger                 Logger
+	RedactedVariables      []string
+	SlowOperationThreshold time.Duration
+
+	// MaskErrors replaces the errors returned by resolvers with an
+	// "Internal server error" carrying a correlationId extension, unless
+	// they implement SafeError. ErrorReporter receives the original errors
+	// along with their correlation ID. ErrorFormatter, when set, formats
+	// every error of the results once masked, including the results of
+	// middlewares and of requests rejected before their execution.
+	MaskErrors     bool
+	ErrorReporter  ErrorReporter
+	ErrorFormatter ErrorFormatter
 }
 
 func NewConfig() *Config {
@@ -195,11 +641,157 @@ func New(p *Config) *Handler {
 		panic("undefined GraphQL schema")
 	}
 
+	persistedQueryStore := p.PersistedQueryStore
+	if persistedQueryStore == nil {
+		persistedQueryStore = NewLRUPersistedQueryStore(DefaultPersistedQueryCacheSize)
+	}
+
+	persistedOperations := make(map[string]string, len(p.PersistedOperations))
+	for id, query := range p.PersistedOperations {
+		persistedOperations[id] = query
+	}
+	if p.PersistedOperationsFile != "" {
+		operations, err := LoadPersistedOperations(p.PersistedOperationsFile)
+		if err != nil {
+			panic(err)
+		}
+		for id, query := range operations {
+			persistedOperations[id] = query
+		}
+	}
+
+	connectionInitTimeout := p.ConnectionInitTimeout
+	if connectionInitTimeout == 0 {
+		connectionInitTimeout = DefaultConnectionInitTimeout
+	}
+
+	maxWebSocketOperations := p.MaxWebSocketOperations
+	if maxWebSocketOperations == 0 {
+		maxWebSocketOperations = DefaultMaxWebSocketOperations
+	}
+
+	sseHeartbeatInterval := p.SSEHeartbeatInterval
+	if sseHeartbeatInterval == 0 {
+		sseHeartbeatInterval = DefaultSSEHeartbeatInterval
+	}
+
+	maxDeferredFragments := p.MaxDeferredFragments
+	if maxDeferredFragments == 0 {
+		maxDeferredFragments = DefaultMaxDeferredFragments
+	}
+
+	deferConcurrency := p.DeferConcurrency
+	if deferConcurrency <= 0 {
+		deferConcurrency = DefaultDeferConcurrency
+	}
+
+	timeoutStatus := p.TimeoutStatus
+	if timeoutStatus == 0 {
+		timeoutStatus = DefaultTimeoutStatus
+	}
+
+	var tracer oteltrace.Tracer
+	if p.TracerProvider != nil {
+		tracer = p.TracerProvider.Tracer(instrumentationName)
+	}
+
+	propagator := p.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	var extensions []graphql.Extension
+	if p.Tracing {
+		extensions = append(extensions, tracingExtension{})
+	}
+	if tracer != nil && p.ResolverSpans {
+		extensions = append(extensions, resolverSpanExtension{tracer: tracer})
+	}
+
+	redacted := p.RedactedVariables
+	if redacted == nil {
+		redacted = DefaultRedactedVariables
+	}
+	redactedVariables := make([]string, len(redacted))
+	for i, name := range redacted {
+		redactedVariables[i] = strings.ToLower(name)
+	}
+
+	var executionSchema *graphql.Schema
+	if len(extensions) > 0 && p.Schema != nil {
+		executionSchema = newExecutionSchema(p.Schema, extensions)
+	}
+
 	return &Handler{
 		Schema:       p.Schema,
 		pretty:       p.Pretty,
 		graphiql:     p.GraphiQL,
 		playground:   p.Playground,
 		rootObjectFn: p.RootObjectFn,
+		contextFn:    p.ContextFn,
+		middlewares:  p.Middlewares,
+
+		onRequest:   p.OnRequest,
+		onParsed:    p.OnParsed,
+		onValidated: p.OnValidated,
+		onExecuted:  p.OnExecuted,
+		onResult:    p.OnResult,
+
+		batchConcurrency:    p.BatchConcurrency,
+		persistedQueryStore: persistedQueryStore,
+
+		maxDeferredFragments: maxDeferredFragments,
+		deferConcurrency:     deferConcurrency,
+
+		persistedOperations:     persistedOperations,
+		persistedOperationsOnly: p.PersistedOperationsOnly,
+
+		documentCache: newDocumentCache(p.DocumentCacheSize),
+
+		graphqlOverHTTP:   p.GraphQLOverHTTP,
+		allowGETMutations: p.AllowGETMutations,
+
+		maxDepth:         p.MaxDepth,
+		maxComplexity:    p.MaxComplexity,
+		fieldCosts:       p.FieldCosts,
+		reportComplexity: p.ReportComplexity,
+
+		disableIntrospection: p.DisableIntrospection,
+		introspectionFn:      p.IntrospectionFn,
+
+		maxBodyBytes:   p.MaxBodyBytes,
+		maxQueryLength: p.MaxQueryLength,
+		maxTokens:      p.MaxTokens,
+		maxAliases:     p.MaxAliases,
+		maxRootFields:  p.MaxRootFields,
+
+		connectionInitFn:       p.ConnectionInitFn,
+		connectionInitTimeout:  connectionInitTimeout,
+		keepAliveInterval:      p.KeepAliveInterval,
+		maxWebSocketOperations: maxWebSocketOperations,
+		sseHeartbeatInterval:   sseHeartbeatInterval,
+		webSocketCheckOrigin:   p.WebSocketCheckOrigin,
+
+		maxUploadSize:  p.MaxUploadSize,
+		maxUploadFiles: p.MaxUploadFiles,
+
+		timeout:       p.Timeout,
+		timeoutFn:     p.TimeoutFn,
+		timeoutStatus: timeoutStatus,
+
+		executionSchema: executionSchema,
+		tracing:         p.Tracing,
+		tracer:          tracer,
+		propagator:      propagator,
+
+		metrics: p.Metrics,
+
+		logger:                 p.Logger,
+		redactedVariables:      redactedVariables,
+		slowOperationThreshold: p.SlowOperationThreshold,
+
+		maskErrors:     p.MaskErrors,
+		errorFormatter: p.ErrorFormatter,
+		errorReporter:  p.ErrorReporter,
 	}
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"sync"
+)
+
+// RequestHook is called with the options of an operation once they are
+// parsed from the request. It may alter them, e.g. to set variables, or set
+// response headers. Returning an error aborts the operation, the error being
+// reported as the result.
+type RequestHook func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) error
+
+// DocumentHook is called with the document of an operation once it is
+// parsed or validated. The document is shared with the document cache and
+// the later requests sending the same query, so it must be treated as
+// read-only. Returning an error aborts the operation, the error being
+// reported as the result.
+type DocumentHook func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, doc *ast.Document) error
+
+// ResultHook is called with the result of an operation. It may alter the
+// result or set response headers. Returning an error replaces the result
+// with the error.
+type ResultHook func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, result *graphql.Result) error
+
+// newHookErrorResult returns the result reporting the error a hook aborted an
+// operation with. The extensions of a gqlerrors.ExtendedError are kept.
+func newHookErrorResult(err error) *graphql.Result {
+	formatted := gqlerrors.FormatError(err)
+	formatted.Extensions = errorExtensions(err)
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+}
+
+// runResultHook calls the OnResult hook before result is serialized,
+// returning the result to write.
+func (h *Handler) runResultHook(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, result *graphql.Result) *graphql.Result {
+	if h.onResult == nil {
+		return result
+	}
+	unlock := lockRequest(ctx)
+	err := h.onResult(ctx, ctxreq, opts, result)
+	unlock()
+	if err != nil {
+		return h.formatErrors(ctx, newHookErrorResult(err))
+	}
+	return result
+}
+
+// requestLockKey is the context key of the mutex serializing the hooks of the
+// operations sharing a request.
+type requestLockKey struct{}
+
+// withRequestLock returns a copy of ctx whose operations call their hooks one
+// at a time.
+func withRequestLock(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestLockKey{}, &sync.Mutex{})
+}
+
+// lockRequest locks the request of ctx before calling a hook, returning the
+// function unlocking it.
+func lockRequest(ctx context.Context) func() {
+	mu, ok := ctx.Value(requestLockKey{}).(*sync.Mutex)
+	if !ok {
+		return func() {}
+	}
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,177 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"testing"
+)
+
+type tenantError struct{}
+
+func (tenantError) Error() string { return "unknown tenant" }
+
+func (tenantError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "FORBIDDEN"}
+}
+
+func newEchoSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"echo": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"value": &graphql.ArgumentConfig{Type: graphql.Int},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Args["value"], nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_Hooks(t *testing.T) {
+	schema := newEchoSchema(t)
+
+	var calls []string
+	h := handler.New(&handler.Config{
+		Schema: &schema,
+		OnRequest: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) error {
+			calls = append(calls, "request")
+			opts.Variables["value"] = 2
+			ctxreq.Response.Header.Set("X-Audit", "logged")
+			return nil
+		},
+		OnParsed: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, doc *ast.Document) error {
+			calls = append(calls, "parsed")
+			return nil
+		},
+		OnValidated: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, doc *ast.Document) error {
+			calls = append(calls, "validated")
+			return nil
+		},
+		OnExecuted: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+			calls = append(calls, "executed")
+			return nil
+		},
+		OnResult: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+			calls = append(calls, "result")
+			result.Extensions = map[string]interface{}{"tenant": "acme"}
+			return nil
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		calls = nil
+		ctx := newHTTPCtx("GET", `/graphql?query=query($value:Int){echo(value:$value)}&variables={"value":1}`, nil)
+		result := executeTest(t, h, ctx)
+
+		if !reflect.DeepEqual(result.Data, map[string]interface{}{"echo": float64(2)}) {
+			t.Fatalf("expected the variables altered by OnRequest, got %v", result.Data)
+		}
+		if !reflect.DeepEqual(result.Extensions, map[string]interface{}{"tenant": "acme"}) {
+			t.Fatalf("expected the extensions set by OnResult, got %v", result.Extensions)
+		}
+		if header := string(ctx.Response.Header.Peek("X-Audit")); header != "logged" {
+			t.Fatalf("expected the header set by OnRequest, got %q", header)
+		}
+
+		// the second request is served from the document cache
+		expected := []string{"request", "parsed", "validated", "executed", "result"}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("wrong hook calls, expected %v, got %v", expected, calls)
+		}
+	}
+}
+
+func TestHandler_Hooks_Abort(t *testing.T) {
+	schema := newEchoSchema(t)
+	abort := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, doc *ast.Document) error {
+		return tenantError{}
+	}
+	cases := map[string]handler.Config{
+		"OnRequest": {Schema: &schema, OnRequest: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) error {
+			return tenantError{}
+		}},
+		"OnParsed":    {Schema: &schema, OnParsed: abort},
+		"OnValidated": {Schema: &schema, OnValidated: abort},
+		"OnExecuted": {Schema: &schema, OnExecuted: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+			return tenantError{}
+		}},
+		"OnResult": {Schema: &schema, OnResult: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+			return errors.New("unknown tenant")
+		}},
+	}
+	for name, config := range cases {
+		config := config
+		h := handler.New(&config)
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={echo}", nil))
+		if result.Data != nil || len(result.Errors) != 1 || result.Errors[0].Message != "unknown tenant" {
+			t.Fatalf("%s: expected the operation to be aborted, got %v", name, result)
+		}
+		if name != "OnResult" && result.Errors[0].Extensions["code"] != "FORBIDDEN" {
+			t.Fatalf("%s: expected the extensions of the error, got %v", name, result.Errors[0].Extensions)
+		}
+	}
+}
+
+func TestHandler_HooksParallelBatch(t *testing.T) {
+	header := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) error {
+		ctxreq.Response.Header.Set("X-Operation", opts.OperationName)
+		return nil
+	}
+	h := handler.New(&handler.Config{
+		Schema:           &testutil.StarWarsSchema,
+		BatchConcurrency: 4,
+		OnRequest:        header,
+		OnParsed: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, doc *ast.Document) error {
+			ctxreq.Response.Header.Set("X-Parsed", opts.OperationName)
+			return nil
+		},
+		OnResult: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+			ctxreq.Response.Header.Set("X-Result", opts.OperationName)
+			return nil
+		},
+	})
+
+	var batch []map[string]string
+	for i := 0; i < 16; i++ {
+		name := fmt.Sprintf("Q%d", i)
+		batch = append(batch, map[string]string{"query": "query " + name + " { hero { name } }", "operationName": name})
+	}
+	body, _ := json.Marshal(batch)
+	ctx := newHTTPCtx("POST", "/graphql", body)
+	ctx.Request.Header.SetContentType("application/json")
+	h.ServeHTTP(ctx)
+
+	var results []*graphql.Result
+	if err := json.Unmarshal(ctx.Response.Body(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("expected %d results, got %d", len(batch), len(results))
+	}
+	for _, result := range results {
+		if result.HasErrors() {
+			t.Fatalf("unexpected errors: %v", result.Errors)
+		}
+	}
+	if len(ctx.Response.Header.Peek("X-Operation")) == 0 {
+		t.Fatal("expected the hooks to set the response header")
+	}
+}
@@ -0,0 +1,552 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/kinds"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"strconv"
+)
+
+// ContentTypeMultipartMixed is the media type of incremental delivery
+// responses.
+const ContentTypeMultipartMixed = "multipart/mixed"
+
+// DeferSpec is the version of the incremental delivery format clients must
+// accept, as the deferSpec parameter of multipart/mixed, to receive deferred
+// and streamed results.
+const DeferSpec = "20220824"
+
+// DefaultMaxDeferredFragments is the default maximum number of deferred
+// fragments of a query.
+const DefaultMaxDeferredFragments = 16
+
+// DefaultDeferConcurrency is the default number of deferred fragments of a
+// query executed in parallel.
+const DefaultDeferConcurrency = 4
+
+// DeferDirective marks fragments whose fields may be delivered after the
+// initial payload of the response.
+var DeferDirective = graphql.NewDirective(graphql.DirectiveConfig{
+	Name:        "defer",
+	Description: "Directs the executor to deliver this fragment after the initial payload of the response.",
+	Locations: []string{
+		graphql.DirectiveLocationFragmentSpread,
+		graphql.DirectiveLocationInlineFragment,
+	},
+	Args: graphql.FieldConfigArgument{
+		"if": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: true,
+			Description:  "Deferred when true or undefined.",
+		},
+		"label": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Unique name identifying the deferred payloads.",
+		},
+	},
+})
+
+// StreamDirective marks list fields whose items past initialCount may be
+// delivered after the initial payload of the response.
+var StreamDirective = graphql.NewDirective(graphql.DirectiveConfig{
+	Name:        "stream",
+	Description: "Directs the executor to deliver the items of this list field past initialCount after the initial payload of the response.",
+	Locations: []string{
+		graphql.DirectiveLocationField,
+	},
+	Args: graphql.FieldConfigArgument{
+		"if": &graphql.ArgumentConfig{
+			Type:         graphql.Boolean,
+			DefaultValue: true,
+			Description:  "Streamed when true or undefined.",
+		},
+		"label": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Unique name identifying the streamed payloads.",
+		},
+		"initialCount": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: 0,
+			Description:  "Number of items delivered in the initial payload.",
+		},
+	},
+})
+
+// NewIncrementalSchema creates a schema registering the @defer and @stream
+// directives along with the directives of config, which default to the
+// specified ones.
+func NewIncrementalSchema(config graphql.SchemaConfig) (graphql.Schema, error) {
+	directives := config.Directives
+	if len(directives) == 0 {
+		directives = graphql.SpecifiedDirectives
+	}
+	config.Directives = append(append([]*graphql.Directive{}, directives...), DeferDirective, StreamDirective)
+	return graphql.NewSchema(config)
+}
+
+// incrementalPayload is a subsequent payload of an incremental delivery
+// response.
+type incrementalPayload struct {
+	Incremental []*incrementalResult `json:"incremental"`
+	HasNext     bool                 `json:"hasNext"`
+}
+
+// incrementalResult is the result of a deferred fragment or a streamed list
+// item, located by its path in the data of the response.
+type incrementalResult struct {
+	Data   interface{}                `json:"data,omitempty"`
+	Items  []interface{}              `json:"items,omitempty"`
+	Path   []interface{}              `json:"path"`
+	Label  string                     `json:"label,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+// initialPayload is the first payload of an incremental delivery response.
+type initialPayload struct {
+	*graphql.Result
+	HasNext bool `json:"hasNext"`
+}
+
+// deferredFragment is a fragment marked with @defer, along with the fields
+// and fragments leading to it from the root of the operation.
+type deferredFragment struct {
+	label     string
+	ancestors []ast.Selection
+	fragment  *ast.InlineFragment
+}
+
+// streamedField is a list field marked with @stream, along with the fields
+// and fragments leading to it from the root of the operation.
+type streamedField struct {
+	label        string
+	ancestors    []ast.Selection
+	field        *ast.Field
+	initialCount int
+}
+
+// incrementalSplitter removes the deferred fragments from an operation,
+// collecting them along with the streamed fields.
+type incrementalSplitter struct {
+	variables map[string]interface{}
+	fragments map[string]*ast.FragmentDefinition
+	deferred  []*deferredFragment
+	streamed  []*streamedField
+}
+
+// acceptsIncrementalDelivery reports whether the Accept header of the request
+// accepts multipart/mixed responses with the supported deferSpec.
+func acceptsIncrementalDelivery(ctxreq *fasthttp.RequestCtx) bool {
+	params, ok := acceptedMediaRange(string(ctxreq.Request.Header.Peek("Accept")), ContentTypeMultipartMixed)
+	return ok && params["deferspec"] == DeferSpec
+}
+
+// serveIncremental executes a query, delivering its deferred fragments and
+// streamed list items as subsequent parts of a multipart/mixed response once
+// the initial payload is written. Deferred fragments are executed in parallel,
+// up to deferConcurrency at a time, along with the fields leading to them,
+// which are resolved again, so queries with more than maxDeferredFragments of
+// them are rejected. Queries
+// without deferred or streamed results, other operations and the results of
+// middlewares short-circuiting them are answered with a regular JSON
+// response.
+func (h *Handler) serveIncremental(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) {
+	var s *incrementalSplitter
+	var params []graphql.ExecuteParams
+	var streamed []*incrementalResult
+	var streamCtx context.Context
+	var cancel context.CancelFunc
+	status := http.StatusOK
+	execute := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result {
+		op, result, rejected := h.prepareOperation(ctx, ctxreq, opts)
+		if result == nil {
+			result, rejected = h.checkGETOperation(ctx, ctxreq, op)
+		}
+		if result != nil {
+			status = rejected
+			return result
+		}
+
+		ctx, stop := h.operationContext(ctx, ctxreq, h.operationTimeout(ctxreq, opts))
+
+		if op.definition == nil || op.definition.Operation != ast.OperationTypeQuery {
+			result = h.executeOperation(ctx, ctxreq, op)
+			stop()
+			status = op.status
+			return result
+		}
+
+		s = &incrementalSplitter{
+			variables: opts.Variables,
+			fragments: getFragments(op.doc),
+		}
+		initial := *op
+		initial.doc = s.document(op.doc, op.definition, s.selectionSet(op.definition.SelectionSet, nil))
+
+		// each deferred fragment resolves the fields leading to it again
+		if h.maxDeferredFragments > 0 && len(s.deferred) > h.maxDeferredFragments {
+			stop()
+			status = h.requestErrorStatus()
+			message := fmt.Sprintf("Query has %d deferred fragments, which exceeds the maximum of %d", len(s.deferred), h.maxDeferredFragments)
+			result := h.formatErrors(ctx, newErrorResult(message, CodeTooManyDeferredFragments))
+			h.reportRejection(opts, op.definition, op.start, result, status)
+			return result
+		}
+
+		// the root objects of the deferred executions are built while the
+		// request is still being handled
+		params = make([]graphql.ExecuteParams, len(s.deferred))
+		for i, deferred := range s.deferred {
+			params[i] = h.newExecuteParams(ctx, ctxreq, opts, deferred.document(s, op.doc, op.definition))
+		}
+
+		result = h.executeOperation(ctx, ctxreq, &initial)
+		streamed = s.streamResults(result.Data)
+		status = initial.status
+		if (len(s.deferred) == 0 && len(streamed) == 0) || initial.status != http.StatusOK {
+			stop()
+			return result
+		}
+		streamCtx, cancel = ctx, stop
+		return result
+	}
+
+	result := h.runMiddlewares(ctx, ctxreq, opts, execute)
+	if cancel == nil {
+		// the operation has nothing to deliver later, was rejected, or a
+		// middleware answered it
+		h.writeJSON(ctxreq, h.runResultHook(ctx, ctxreq, opts, result), status)
+		return
+	}
+
+	ctxreq.Response.SetStatusCode(status)
+	ctxreq.Response.Header.SetContentType(ContentTypeMultipartMixed + `; boundary="-"; deferSpec=` + DeferSpec)
+	ctxreq.Response.Header.Set("Cache-Control", "no-cache")
+	ctxreq.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		deferred := make(chan []*incrementalResult, len(s.deferred))
+		sem := make(chan struct{}, h.deferConcurrency)
+		for i := range s.deferred {
+			go func(i int) {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				deferred <- s.deferred[i].results(h.formatErrors(streamCtx, graphql.Execute(params[i])))
+			}(i)
+		}
+
+		// the client went away once a write fails; the context is cancelled
+		// so the pending executions return early
+		pending := len(s.deferred)
+		if writePart(w, &initialPayload{Result: result, HasNext: true}) != nil {
+			cancel()
+		}
+		if len(streamed) > 0 && streamCtx.Err() == nil {
+			if writePart(w, &incrementalPayload{Incremental: streamed, HasNext: pending > 0}) != nil {
+				cancel()
+			}
+		}
+		for ; pending > 0; pending-- {
+			results := <-deferred
+			if len(results) == 0 && pending > 1 {
+				// the fragment applied to no object
+				continue
+			}
+			if streamCtx.Err() == nil && writePart(w, &incrementalPayload{Incremental: results, HasNext: pending > 1}) != nil {
+				cancel()
+			}
+		}
+		if streamCtx.Err() == nil {
+			w.WriteString("\r\n-----\r\n")
+			w.Flush()
+		}
+	})
+}
+
+// writePart writes and flushes a part of a multipart/mixed response carrying
+// v as JSON.
+func writePart(w *bufio.Writer, v interface{}) error {
+	w.WriteString("\r\n---\r\nContent-Type: " + ContentTypeJSON + "; charset=utf-8\r\n\r\n")
+	buff, _ := json.Marshal(v)
+	w.Write(buff)
+	return w.Flush()
+}
+
+// selectionSet returns a copy of set without its deferred fragments, collecting
+// them along with the streamed fields. Fragment spreads are inlined so the
+// fragments they defer are found with the path leading to them.
+func (s *incrementalSplitter) selectionSet(set *ast.SelectionSet, ancestors []ast.Selection) *ast.SelectionSet {
+	if set == nil {
+		return nil
+	}
+
+	out := &ast.SelectionSet{Kind: set.Kind, Loc: set.Loc}
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			field := *selection
+			field.SelectionSet = s.selectionSet(selection.SelectionSet, appendSelection(ancestors, &field))
+			if label, initialCount, ok := s.streamArguments(selection.Directives); ok {
+				s.streamed = append(s.streamed, &streamedField{
+					label:        label,
+					ancestors:    ancestors,
+					field:        &field,
+					initialCount: initialCount,
+				})
+			}
+			out.Selections = append(out.Selections, &field)
+		case *ast.InlineFragment:
+			if fragment := s.inlineFragment(selection, ancestors); fragment != nil {
+				out.Selections = append(out.Selections, fragment)
+			}
+		case *ast.FragmentSpread:
+			definition, ok := s.fragments[selection.Name.Value]
+			if !ok {
+				continue
+			}
+			spread := &ast.InlineFragment{
+				Kind:          kinds.InlineFragment,
+				Loc:           selection.Loc,
+				TypeCondition: definition.TypeCondition,
+				Directives:    selection.Directives,
+				SelectionSet:  definition.SelectionSet,
+			}
+			if fragment := s.inlineFragment(spread, ancestors); fragment != nil {
+				out.Selections = append(out.Selections, fragment)
+			}
+		}
+	}
+	return out
+}
+
+// inlineFragment returns a copy of fragment without its deferred fragments,
+// or nil when fragment itself is deferred.
+func (s *incrementalSplitter) inlineFragment(fragment *ast.InlineFragment, ancestors []ast.Selection) *ast.InlineFragment {
+	if label, ok := s.deferArguments(fragment.Directives); ok {
+		s.deferred = append(s.deferred, &deferredFragment{
+			label:     label,
+			ancestors: ancestors,
+			fragment:  fragment,
+		})
+		return nil
+	}
+
+	copied := *fragment
+	copied.SelectionSet = s.selectionSet(fragment.SelectionSet, appendSelection(ancestors, &copied))
+	return &copied
+}
+
+// deferArguments returns the label of a @defer directive, reporting whether
+// the directives defer their fragment.
+func (s *incrementalSplitter) deferArguments(directives []*ast.Directive) (string, bool) {
+	directive := findDirective(directives, DeferDirective.Name)
+	if directive == nil || !s.boolArgument(directive, "if", true) {
+		return "", false
+	}
+	return stringArgument(directive, "label"), true
+}
+
+// streamArguments returns the label and initial count of a @stream directive,
+// reporting whether the directives stream their field.
+func (s *incrementalSplitter) streamArguments(directives []*ast.Directive) (string, int, bool) {
+	directive := findDirective(directives, StreamDirective.Name)
+	if directive == nil || !s.boolArgument(directive, "if", true) {
+		return "", 0, false
+	}
+
+	initialCount := 0
+	if argument := findArgument(directive, "initialCount"); argument != nil {
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			initialCount, _ = strconv.Atoi(value.Value)
+		case *ast.Variable:
+			initialCount, _ = toInt(s.variables[value.Name.Value])
+		}
+	}
+	if initialCount < 0 {
+		initialCount = 0
+	}
+	return stringArgument(directive, "label"), initialCount, true
+}
+
+// boolArgument returns the value of a boolean argument of directive,
+// resolving variables.
+func (s *incrementalSplitter) boolArgument(directive *ast.Directive, name string, defaultValue bool) bool {
+	argument := findArgument(directive, name)
+	if argument == nil {
+		return defaultValue
+	}
+	switch value := argument.Value.(type) {
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.Variable:
+		if b, ok := s.variables[value.Name.Value].(bool); ok {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// document returns a document holding a copy of operation selecting set,
+// along with the fragments of doc.
+func (s *incrementalSplitter) document(doc *ast.Document, operation *ast.OperationDefinition, set *ast.SelectionSet) *ast.Document {
+	copied := *operation
+	copied.SelectionSet = set
+
+	definitions := []ast.Node{&copied}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			definitions = append(definitions, fragment)
+		}
+	}
+	return &ast.Document{Kind: kinds.Document, Loc: doc.Loc, Definitions: definitions}
+}
+
+// streamResults truncates the streamed lists of data to their initial count,
+// returning their remaining items.
+func (s *incrementalSplitter) streamResults(data interface{}) []*incrementalResult {
+	var results []*incrementalResult
+	for _, streamed := range s.streamed {
+		key := responseKey(streamed.field)
+		walkResponse(data, streamed.ancestors, nil, func(value interface{}, path []interface{}) {
+			object, _ := value.(map[string]interface{})
+			items, _ := object[key].([]interface{})
+			if len(items) <= streamed.initialCount {
+				return
+			}
+
+			object[key] = items[:streamed.initialCount]
+			for i, item := range items[streamed.initialCount:] {
+				results = append(results, &incrementalResult{
+					Items: []interface{}{item},
+					Path:  appendPath(path, key, streamed.initialCount+i),
+					Label: streamed.label,
+				})
+			}
+		})
+	}
+	return results
+}
+
+// document returns a document selecting only the deferred fragment, through
+// the fields and fragments leading to it.
+func (d *deferredFragment) document(s *incrementalSplitter, doc *ast.Document, operation *ast.OperationDefinition) *ast.Document {
+	var selection ast.Selection = d.fragment
+	for i := len(d.ancestors) - 1; i >= 0; i-- {
+		set := &ast.SelectionSet{Kind: kinds.SelectionSet, Selections: []ast.Selection{selection}}
+		switch ancestor := d.ancestors[i].(type) {
+		case *ast.Field:
+			field := *ancestor
+			field.SelectionSet = set
+			selection = &field
+		case *ast.InlineFragment:
+			fragment := *ancestor
+			fragment.SelectionSet = set
+			selection = &fragment
+		}
+	}
+	return s.document(doc, operation, &ast.SelectionSet{Kind: kinds.SelectionSet, Selections: []ast.Selection{selection}})
+}
+
+// results returns a result per object the deferred fragment applies to in the
+// result of its execution.
+func (d *deferredFragment) results(result *graphql.Result) []*incrementalResult {
+	results := []*incrementalResult{}
+	walkResponse(result.Data, d.ancestors, nil, func(value interface{}, path []interface{}) {
+		object, ok := value.(map[string]interface{})
+		if !ok || (len(object) == 0 && d.fragment.TypeCondition != nil) {
+			// the fragment does not apply to this object
+			return
+		}
+		results = append(results, &incrementalResult{
+			Data:  object,
+			Path:  appendPath(path),
+			Label: d.label,
+		})
+	})
+
+	if len(result.Errors) > 0 {
+		if len(results) == 0 {
+			results = append(results, &incrementalResult{Path: []interface{}{}, Label: d.label})
+		}
+		results[0].Errors = result.Errors
+	}
+	return results
+}
+
+// walkResponse calls visit with every value of data reached through the
+// fields of ancestors, along with its path. Lists are walked item by item.
+func walkResponse(data interface{}, ancestors []ast.Selection, path []interface{}, visit func(value interface{}, path []interface{})) {
+	if items, ok := data.([]interface{}); ok {
+		for i, item := range items {
+			walkResponse(item, ancestors, appendPath(path, i), visit)
+		}
+		return
+	}
+	if len(ancestors) == 0 {
+		visit(data, path)
+		return
+	}
+
+	switch ancestor := ancestors[0].(type) {
+	case *ast.Field:
+		if object, ok := data.(map[string]interface{}); ok {
+			key := responseKey(ancestor)
+			walkResponse(object[key], ancestors[1:], appendPath(path, key), visit)
+		}
+	case *ast.InlineFragment:
+		walkResponse(data, ancestors[1:], path, visit)
+	}
+}
+
+// responseKey returns the key of field in the response data.
+func responseKey(field *ast.Field) string {
+	if field.Alias != nil {
+		return field.Alias.Value
+	}
+	return field.Name.Value
+}
+
+func findDirective(directives []*ast.Directive, name string) *ast.Directive {
+	for _, directive := range directives {
+		if directive.Name != nil && directive.Name.Value == name {
+			return directive
+		}
+	}
+	return nil
+}
+
+func findArgument(directive *ast.Directive, name string) *ast.Argument {
+	for _, argument := range directive.Arguments {
+		if argument.Name != nil && argument.Name.Value == name {
+			return argument
+		}
+	}
+	return nil
+}
+
+func stringArgument(directive *ast.Directive, name string) string {
+	if argument := findArgument(directive, name); argument != nil {
+		if value, ok := argument.Value.(*ast.StringValue); ok {
+			return value.Value
+		}
+	}
+	return ""
+}
+
+// appendSelection returns a copy of selections with selection appended, so
+// sibling selections don't share the backing array.
+func appendSelection(selections []ast.Selection, selection ast.Selection) []ast.Selection {
+	return append(append(make([]ast.Selection, 0, len(selections)+1), selections...), selection)
+}
+
+// appendPath returns a copy of path with elements appended.
+func appendPath(path []interface{}, elements ...interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(path)+len(elements)), path...), elements...)
+}
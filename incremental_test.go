@@ -0,0 +1,179 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func newHeroSchema(t *testing.T) graphql.Schema {
+	hero := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Hero",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.String},
+			"bio":  &graphql.Field{Type: graphql.String},
+		},
+	})
+	schema, err := handler.NewIncrementalSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"heroes": &graphql.Field{
+					Type: graphql.NewList(hero),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{
+							map[string]interface{}{"name": "Luke", "bio": "Jedi"},
+							map[string]interface{}{"name": "Leia", "bio": "General"},
+							map[string]interface{}{"name": "Han", "bio": "Smuggler"},
+						}, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// serveIncrementalTest serves h on an in-memory listener and sends it a GET
+// request accepting incremental delivery, returning the JSON parts of the
+// response.
+func serveIncrementalTest(t *testing.T, h *handler.Handler, query string) (*http.Response, []map[string]interface{}) {
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: h.ServeHTTP}
+	go server.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) { return ln.Dial() },
+	}}
+	req, _ := http.NewRequest("GET", "http://localhost/graphql?query="+url.QueryEscape(query), nil)
+	req.Header.Set("Accept", "multipart/mixed;deferSpec=20220824, application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		var part map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&part)
+		return resp, []map[string]interface{}{part}
+	}
+
+	var parts []map[string]interface{}
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(part).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, payload)
+	}
+	return resp, parts
+}
+
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestIncremental_Defer(t *testing.T) {
+	schema := newHeroSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	resp, parts := serveIncrementalTest(t, h, `{ heroes { name ...Bio @defer(label: "bio") } } fragment Bio on Hero { bio }`)
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != `multipart/mixed; boundary="-"; deferSpec=20220824` {
+		t.Fatalf("unexpected content type, got %q", contentType)
+	}
+
+	expected := []map[string]interface{}{
+		decodeJSON(t, `{"data":{"heroes":[{"name":"Luke"},{"name":"Leia"},{"name":"Han"}]},"hasNext":true}`),
+		decodeJSON(t, `{"incremental":[
+			{"data":{"bio":"Jedi"},"path":["heroes",0],"label":"bio"},
+			{"data":{"bio":"General"},"path":["heroes",1],"label":"bio"},
+			{"data":{"bio":"Smuggler"},"path":["heroes",2],"label":"bio"}
+		],"hasNext":false}`),
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Fatalf("wrong parts, expected %v, got %v", expected, parts)
+	}
+}
+
+func TestIncremental_Stream(t *testing.T) {
+	schema := newHeroSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	_, parts := serveIncrementalTest(t, h, `{ heroes @stream(initialCount: 1) { name } }`)
+
+	expected := []map[string]interface{}{
+		decodeJSON(t, `{"data":{"heroes":[{"name":"Luke"}]},"hasNext":true}`),
+		decodeJSON(t, `{"incremental":[
+			{"items":[{"name":"Leia"}],"path":["heroes",1]},
+			{"items":[{"name":"Han"}],"path":["heroes",2]}
+		],"hasNext":false}`),
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Fatalf("wrong parts, expected %v, got %v", expected, parts)
+	}
+}
+
+func TestIncremental_NotDeferred(t *testing.T) {
+	schema := newHeroSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	for _, query := range []string{
+		`{ heroes { name } }`,
+		`{ heroes { name ... @defer(if: false) { bio } } }`,
+	} {
+		resp, parts := serveIncrementalTest(t, h, query)
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+			t.Fatalf("unexpected content type for %s, got %q", query, contentType)
+		}
+		if _, ok := parts[0]["hasNext"]; ok {
+			t.Fatalf("unexpected hasNext for %s, got %v", query, parts[0])
+		}
+	}
+}
+
+func TestIncremental_MaxDeferredFragments(t *testing.T) {
+	schema := newHeroSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema, MaxDeferredFragments: 2})
+
+	_, parts := serveIncrementalTest(t, h, `{ heroes { name ...Bio @defer(label: "a") ...Bio @defer(label: "b") ...Bio @defer(label: "c") } } fragment Bio on Hero { bio }`)
+	if len(parts) != 1 || parts[0]["data"] != nil {
+		t.Fatalf("expected the query to be rejected, got %v", parts)
+	}
+	errors, _ := parts[0]["errors"].([]interface{})
+	if len(errors) != 1 || !reflect.DeepEqual(errors[0].(map[string]interface{})["extensions"], map[string]interface{}{"code": "TOO_MANY_DEFERRED_FRAGMENTS"}) {
+		t.Fatalf("expected a TOO_MANY_DEFERRED_FRAGMENTS error, got %v", parts[0])
+	}
+
+	_, parts = serveIncrementalTest(t, h, `{ heroes { name ...Bio @defer(label: "a") ...Bio @defer(label: "b") } } fragment Bio on Hero { bio }`)
+	if len(parts) != 3 {
+		t.Fatalf("expected the deferred fragments to be delivered, got %v", parts)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+)
+
+// IntrospectionFn decides per request whether introspection is allowed while
+// it is disabled, e.g. to let administrators introspect the schema.
+type IntrospectionFn func(ctx *fasthttp.RequestCtx) bool
+
+// introspectionAllowed reports whether the request may select introspection
+// fields.
+func (h *Handler) introspectionAllowed(ctxreq *fasthttp.RequestCtx) bool {
+	if !h.disableIntrospection {
+		return true
+	}
+	return h.introspectionFn != nil && h.introspectionFn(ctxreq)
+}
+
+// selectsIntrospection reports whether operation selects the `__schema` or
+// `__type` introspection fields, following fragments.
+func selectsIntrospection(doc *ast.Document, operation *ast.OperationDefinition) bool {
+	fragments := getFragments(doc)
+	visited := map[string]bool{}
+
+	var walk func(set *ast.SelectionSet) bool
+	walk = func(set *ast.SelectionSet) bool {
+		if set == nil {
+			return false
+		}
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if name := selection.Name.Value; name == "__schema" || name == "__type" {
+					return true
+				}
+				if walk(selection.SelectionSet) {
+					return true
+				}
+			case *ast.InlineFragment:
+				if walk(selection.SelectionSet) {
+					return true
+				}
+			case *ast.FragmentSpread:
+				name := selection.Name.Value
+				if fragment, ok := fragments[name]; ok && !visited[name] {
+					visited[name] = true
+					if walk(fragment.SelectionSet) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	return walk(operation.SelectionSet)
+}
@@ -0,0 +1,58 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"net/url"
+	"testing"
+)
+
+func TestHandler_DisableIntrospection(t *testing.T) {
+	cases := map[string]struct {
+		query         string
+		admin         bool
+		expectsErrors bool
+	}{
+		"rejects __schema": {
+			query:         `{ __schema { queryType { name } } }`,
+			expectsErrors: true,
+		},
+		"rejects __type in fragments": {
+			query:         `{ ...Types } fragment Types on Query { __type(name: "Droid") { name } }`,
+			expectsErrors: true,
+		},
+		"allows __typename": {
+			query: `{ __typename hero { __typename name } }`,
+		},
+		"allows introspection when the predicate does": {
+			query: `{ __schema { queryType { name } } }`,
+			admin: true,
+		},
+	}
+
+	h := handler.New(&handler.Config{
+		Schema:               &testutil.StarWarsSchema,
+		DisableIntrospection: true,
+		IntrospectionFn: func(ctx *fasthttp.RequestCtx) bool {
+			return string(ctx.Request.Header.Peek("X-Admin")) == "true"
+		},
+	})
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			httpCtx := newHTTPCtx("GET", "/graphql?query="+url.QueryEscape(tc.query), nil)
+			if tc.admin {
+				httpCtx.Request.Header.Set("X-Admin", "true")
+			}
+			result := executeTest(t, h, httpCtx)
+
+			if result.HasErrors() != tc.expectsErrors {
+				t.Fatalf("wrong errors, expected errors: %v, got %v", tc.expectsErrors, result.Errors)
+			}
+			if tc.expectsErrors && result.Errors[0].Message != "GraphQL introspection is not allowed" {
+				t.Fatalf("wrong error message, got %v", result.Errors[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/lexer"
+	"github.com/graphql-go/graphql/language/source"
+	"unicode/utf8"
+)
+
+// checkQueryLimits enforces the limits that apply to the query text, before
+// it is parsed. It returns a non-nil result when the query is rejected.
+func (h *Handler) checkQueryLimits(query string) *graphql.Result {
+	if h.maxQueryLength > 0 {
+		if length := utf8.RuneCountInString(query); length > h.maxQueryLength {
+			message := fmt.Sprintf("Query has %d characters, which exceeds the maximum of %d", length, h.maxQueryLength)
+			return newErrorResult(message, CodeQueryTooLarge)
+		}
+	}
+
+	if h.maxTokens > 0 && exceedsTokens(query, h.maxTokens) {
+		message := fmt.Sprintf("Query exceeds the maximum of %d tokens", h.maxTokens)
+		return newErrorResult(message, CodeQueryTooLarge)
+	}
+
+	return nil
+}
+
+// exceedsTokens reports whether query holds more than max tokens. Lexing
+// stops as soon as the limit is reached or on the first syntax error, which
+// is left for the parser to report.
+func exceedsTokens(query string, max int) bool {
+	lex := lexer.Lex(source.NewSource(&source.Source{Body: []byte(query)}))
+	for count := 0; ; count++ {
+		token, err := lex(0)
+		if err != nil || token.Kind == lexer.EOF {
+			return false
+		}
+		if count >= max {
+			return true
+		}
+	}
+}
+
+// checkDocumentLimits enforces the limits that apply to a parsed operation.
+// It returns a non-nil result when the operation is rejected.
+func (h *Handler) checkDocumentLimits(doc *ast.Document, operation *ast.OperationDefinition) *graphql.Result {
+	if h.maxAliases > 0 {
+		if aliases := countAliases(doc); aliases > h.maxAliases {
+			message := fmt.Sprintf("Query has %d aliases, which exceeds the maximum of %d", aliases, h.maxAliases)
+			return newErrorResult(message, CodeQueryTooLarge)
+		}
+	}
+
+	if h.maxRootFields > 0 && operation != nil {
+		if fields := countRootFields(doc, operation); fields > h.maxRootFields {
+			message := fmt.Sprintf("Operation selects %d root fields, which exceeds the maximum of %d", fields, h.maxRootFields)
+			return newErrorResult(message, CodeQueryTooLarge)
+		}
+	}
+
+	return nil
+}
+
+// countAliases returns the number of aliased fields in doc.
+func countAliases(doc *ast.Document) int {
+	var count func(set *ast.SelectionSet) int
+	count = func(set *ast.SelectionSet) int {
+		if set == nil {
+			return 0
+		}
+		aliases := 0
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if selection.Alias != nil {
+					aliases++
+				}
+				aliases += count(selection.SelectionSet)
+			case *ast.InlineFragment:
+				aliases += count(selection.SelectionSet)
+			}
+		}
+		return aliases
+	}
+
+	aliases := 0
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.OperationDefinition:
+			aliases += count(definition.SelectionSet)
+		case *ast.FragmentDefinition:
+			aliases += count(definition.SelectionSet)
+		}
+	}
+	return aliases
+}
+
+// countRootFields returns the number of fields operation selects on the root
+// type, following fragments.
+func countRootFields(doc *ast.Document, operation *ast.OperationDefinition) int {
+	fragments := getFragments(doc)
+	visited := map[string]bool{}
+
+	var count func(set *ast.SelectionSet) int
+	count = func(set *ast.SelectionSet) int {
+		if set == nil {
+			return 0
+		}
+		fields := 0
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				fields++
+			case *ast.InlineFragment:
+				fields += count(selection.SelectionSet)
+			case *ast.FragmentSpread:
+				name := selection.Name.Value
+				if fragment, ok := fragments[name]; ok && !visited[name] {
+					visited[name] = true
+					fields += count(fragment.SelectionSet)
+				}
+			}
+		}
+		return fields
+	}
+	return count(operation.SelectionSet)
+}
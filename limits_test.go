@@ -0,0 +1,111 @@
+package handler_test
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestHandler_Limits(t *testing.T) {
+	cases := map[string]struct {
+		config             handler.Config
+		query              string
+		expectedStatusCode int
+	}{
+		"rejects long queries": {
+			config:             handler.Config{MaxQueryLength: 10},
+			query:              `{ hero { name } }`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"rejects queries with too many tokens": {
+			config:             handler.Config{MaxTokens: 5},
+			query:              `{ hero { name } }`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"allows queries within the token limit": {
+			config:             handler.Config{MaxTokens: 6},
+			query:              `{ hero { name } }`,
+			expectedStatusCode: http.StatusOK,
+		},
+		"rejects queries with too many aliases": {
+			config:             handler.Config{MaxAliases: 1},
+			query:              `{ a: hero { name } ...F } fragment F on Query { b: hero { name } }`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"rejects operations with too many root fields": {
+			config:             handler.Config{MaxRootFields: 2},
+			query:              `{ hero { name } ... on Query { a: hero { id } } b: hero { id } }`,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"allows operations within the root fields limit": {
+			config:             handler.Config{MaxRootFields: 2},
+			query:              `{ hero { name } a: hero { id } }`,
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			config := tc.config
+			config.Schema = &testutil.StarWarsSchema
+			h := handler.New(&config)
+
+			httpCtx := newHTTPCtx("GET", "/graphql?query="+url.QueryEscape(tc.query), nil)
+			result := executeTest(t, h, httpCtx)
+
+			if statusCode := httpCtx.Response.StatusCode(); statusCode != tc.expectedStatusCode {
+				t.Fatalf("wrong status code, expected %v, got %v: %v", tc.expectedStatusCode, statusCode, result.Errors)
+			}
+			if result.HasErrors() != (tc.expectedStatusCode != http.StatusOK) {
+				t.Fatalf("unexpected errors %v", result.Errors)
+			}
+		})
+	}
+}
+
+func TestHandler_MaxBodyBytes(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema:       &testutil.StarWarsSchema,
+		MaxBodyBytes: 16,
+	})
+
+	httpCtx := newHTTPCtx("POST", "/graphql", []byte(`{"query": "{ hero { name } }"}`))
+	httpCtx.Request.Header.SetContentType("application/json")
+	result := executeTest(t, h, httpCtx)
+
+	if statusCode := httpCtx.Response.StatusCode(); statusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("wrong status code, expected %v, got %v", http.StatusRequestEntityTooLarge, statusCode)
+	}
+	if !result.HasErrors() {
+		t.Fatalf("expected errors")
+	}
+}
+
+func TestHandler_LimitsSkipValidation(t *testing.T) {
+	h, exporter := newTelemetryHandler(&handler.Config{MaxAliases: 10})
+
+	query := "{"
+	for i := 0; i < 100; i++ {
+		query += fmt.Sprintf(" a%d: hero { name }", i)
+	}
+	query += " }"
+	httpCtx := newHTTPCtx("GET", "/graphql?query="+url.QueryEscape(query), nil)
+	result := executeTest(t, h, httpCtx)
+
+	if statusCode := httpCtx.Response.StatusCode(); statusCode != http.StatusBadRequest {
+		t.Fatalf("wrong status code, expected %v, got %v: %v", http.StatusBadRequest, statusCode, result.Errors)
+	}
+	spans := spansByName(exporter)
+	if _, ok := spans[handler.SpanParse]; !ok {
+		t.Fatalf("expected the document to be parsed, got %v", spans)
+	}
+	if _, ok := spans[handler.SpanValidate]; ok {
+		t.Fatal("expected the validation to be skipped for documents exceeding the limits")
+	}
+	if stats := h.DocumentCacheStats(); stats.Size != 0 {
+		t.Fatalf("expected the document not to be cached, got %+v", stats)
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"strings"
+	"time"
+)
+
+// Logger records the operations of a Handler. A *slog.Logger satisfies it.
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// RedactedValue replaces the values of the redacted variables in the logs.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactedVariables are the variable names redacted from the logs when
+// Config.RedactedVariables is not set.
+var DefaultRedactedVariables = []string{"password", "secret", "token", "authorization", "apikey", "creditcard"}
+
+// logOperation logs an answered operation, or a rejected request, along with
+// its document and the timings of its phases when it exceeded the slow
+// operation threshold. Subscriptions are not logged.
+func (h *Handler) logOperation(r *operationReport) {
+	if h.logger == nil {
+		return
+	}
+
+	args := []interface{}{
+		"operation_name", r.name(),
+		"operation_type", r.operationType(),
+		"document_hash", documentHash(r.opts.Query),
+		"variables", h.redactVariables(r.opts.Variables),
+		"duration", r.duration,
+		"status", r.status,
+		"errors", len(r.result.Errors),
+	}
+	h.logger.Info("GraphQL operation", args...)
+
+	if h.slowOperationThreshold <= 0 || r.duration < h.slowOperationThreshold {
+		return
+	}
+
+	var parsing, validation time.Duration
+	if r.trace != nil {
+		parsing = time.Duration(r.trace.parsing.Duration)
+		validation = time.Duration(r.trace.validation.Duration)
+	}
+	args = append(args,
+		"document", r.opts.Query,
+		"parsing", parsing,
+		"validation", validation,
+		"execution", r.execution,
+	)
+	h.logger.Warn("Slow GraphQL operation", args...)
+}
+
+// redactVariables returns a copy of variables where the values of the
+// variables and input fields whose name contains one of the redacted names,
+// regardless of case, are replaced with RedactedValue. Uploaded files are
+// replaced with their name.
+func (h *Handler) redactVariables(variables map[string]interface{}) map[string]interface{} {
+	if variables == nil {
+		return nil
+	}
+
+	redacted := make(map[string]interface{}, len(variables))
+	for name, value := range variables {
+		if h.isRedacted(name) {
+			redacted[name] = RedactedValue
+		} else {
+			redacted[name] = h.redactValue(value)
+		}
+	}
+	return redacted
+}
+
+func (h *Handler) redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return h.redactVariables(value)
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = h.redactValue(item)
+		}
+		return list
+	case *UploadedFile:
+		return value.Filename
+	}
+	return value
+}
+
+// isRedacted reports whether the values of the variable name are redacted.
+func (h *Handler) isRedacted(name string) bool {
+	name = strings.ToLower(name)
+	for _, redacted := range h.redactedVariables {
+		if strings.Contains(name, redacted) {
+			return true
+		}
+	}
+	return false
+}
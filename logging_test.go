@@ -0,0 +1,202 @@
+package handler_test
+
+import (
+	"bytes"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logRecord is a record of testLogger.
+type logRecord struct {
+	level string
+	msg   string
+	attrs map[string]interface{}
+}
+
+// testLogger records the logs of a handler.
+type testLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *testLogger) Info(msg string, args ...interface{}) {
+	l.record("INFO", msg, args)
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.record("WARN", msg, args)
+}
+
+func (l *testLogger) record(level, msg string, args []interface{}) {
+	attrs := map[string]interface{}{}
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[args[i].(string)] = args[i+1]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, attrs: attrs})
+}
+
+func TestHandler_Logger(t *testing.T) {
+	logger := &testLogger{}
+	h := handler.New(&handler.Config{
+		Schema:            &testutil.StarWarsSchema,
+		Logger:            logger,
+		RedactedVariables: []string{"Secret"},
+	})
+
+	body := []byte(`{
+		"query": "query HeroName($episode: Episode, $apiSecret: String, $input: Input) { hero(episode: $episode) { name } }",
+		"variables": {"episode": "JEDI", "apiSecret": "hunter2", "input": {"mySecret": "s3cr3t", "items": [{"secretKey": "k"}]}}
+	}`)
+	ctx := newHTTPCtx("POST", "/graphql", body)
+	ctx.Request.Header.SetContentType("application/json")
+	h.ServeHTTP(ctx)
+
+	if len(logger.records) != 1 {
+		t.Fatalf("expected a single record, got %v", logger.records)
+	}
+	record := logger.records[0]
+	if record.level != "INFO" || record.msg != "GraphQL operation" {
+		t.Fatalf("wrong record: %v", record)
+	}
+
+	expected := map[string]interface{}{
+		"operation_name": "HeroName",
+		"status":         http.StatusOK,
+		"variables": map[string]interface{}{
+			"episode":   "JEDI",
+			"apiSecret": handler.RedactedValue,
+			"input": map[string]interface{}{
+				"mySecret": handler.RedactedValue,
+				"items":    []interface{}{map[string]interface{}{"secretKey": handler.RedactedValue}},
+			},
+		},
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(record.attrs[key], value) {
+			t.Fatalf("wrong %s, expected %v, got %v", key, value, record.attrs[key])
+		}
+	}
+	if hash, _ := record.attrs["document_hash"].(string); len(hash) != 64 {
+		t.Fatalf("expected a SHA-256 document hash, got %v", record.attrs["document_hash"])
+	}
+	if _, ok := record.attrs["document"]; ok {
+		t.Fatal("expected no document outside of the slow operation log")
+	}
+}
+
+func TestHandler_LoggerRejectedOperation(t *testing.T) {
+	logger := &testLogger{}
+	h := handler.New(&handler.Config{
+		Schema:          &testutil.StarWarsSchema,
+		Logger:          logger,
+		GraphQLOverHTTP: true,
+	})
+
+	ctx := newHTTPCtx("GET", "/graphql?query={hero{unknown}}", nil)
+	ctx.Request.Header.Set("Accept", handler.ContentTypeJSON)
+	h.ServeHTTP(ctx)
+
+	if len(logger.records) != 1 {
+		t.Fatalf("expected a single record, got %v", logger.records)
+	}
+	attrs := logger.records[0].attrs
+	if attrs["status"] != http.StatusBadRequest || attrs["errors"] != 1 {
+		t.Fatalf("wrong status or error count: %v", attrs)
+	}
+}
+
+func TestHandler_LoggerRejectedRequest(t *testing.T) {
+	cases := map[string]struct {
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		"unsupported method":  {method: "PUT", expectedStatus: http.StatusMethodNotAllowed},
+		"oversized body":      {method: "POST", body: `{"query":"{hero{name}}", "padding": "xxxxxxxxxxxxxxxx"}`, expectedStatus: http.StatusRequestEntityTooLarge},
+		"malformed body":      {method: "POST", body: `{"query":`, expectedStatus: http.StatusBadRequest},
+		"mutation over a GET": {method: "GET", expectedStatus: http.StatusMethodNotAllowed},
+	}
+	for name, tc := range cases {
+		logger := &testLogger{}
+		metrics := handler.NewMetrics()
+		h := handler.New(&handler.Config{
+			Schema:          &testutil.StarWarsSchema,
+			Logger:          logger,
+			Metrics:         metrics,
+			GraphQLOverHTTP: true,
+			MaxBodyBytes:    48,
+		})
+
+		url := "/graphql"
+		if tc.method == "GET" {
+			url = "/graphql?query=mutation{unknown}"
+		}
+		var body []byte
+		if tc.body != "" {
+			body = []byte(tc.body)
+		}
+		ctx := newHTTPCtx(tc.method, url, body)
+		ctx.Request.Header.SetContentType(handler.ContentTypeJSON)
+		h.ServeHTTP(ctx)
+
+		if ctx.Response.StatusCode() != tc.expectedStatus {
+			t.Fatalf("%s: unexpected status code, got %d: %s", name, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+		if len(logger.records) != 1 {
+			t.Fatalf("%s: expected a single record, got %v", name, logger.records)
+		}
+		if attrs := logger.records[0].attrs; attrs["status"] != tc.expectedStatus || attrs["errors"] != 1 {
+			t.Fatalf("%s: wrong status or error count: %v", name, attrs)
+		}
+
+		var buf bytes.Buffer
+		metrics.WritePrometheus(&buf)
+		if !strings.Contains(buf.String(), "graphql_operations_total{") {
+			t.Fatalf("%s: expected the request to be observed, got:\n%s", name, buf.String())
+		}
+	}
+}
+
+func TestHandler_SlowOperationThreshold(t *testing.T) {
+	logger := &testLogger{}
+	schema := newSlowSchema(t, make(chan error, 1))
+	h := handler.New(&handler.Config{
+		Schema:                 &schema,
+		Logger:                 logger,
+		Timeout:                50 * time.Millisecond,
+		SlowOperationThreshold: 10 * time.Millisecond,
+	})
+
+	h.ServeHTTP(newHTTPCtx("GET", "/graphql?query={slow}", nil))
+
+	if len(logger.records) != 2 {
+		t.Fatalf("expected an operation and a slow operation record, got %v", logger.records)
+	}
+	record := logger.records[1]
+	if record.level != "WARN" || record.msg != "Slow GraphQL operation" {
+		t.Fatalf("wrong record: %v", record)
+	}
+	if record.attrs["document"] != "{slow}" {
+		t.Fatalf("expected the document, got %v", record.attrs["document"])
+	}
+	if record.attrs["status"] != http.StatusGatewayTimeout {
+		t.Fatalf("expected the timeout status, got %v", record.attrs["status"])
+	}
+	for _, key := range []string{"parsing", "validation", "execution"} {
+		if _, ok := record.attrs[key].(time.Duration); !ok {
+			t.Fatalf("expected the %s timing, got %v", key, record.attrs[key])
+		}
+	}
+	if execution := record.attrs["execution"].(time.Duration); execution < 10*time.Millisecond {
+		t.Fatalf("expected the execution to take the time, got %v", execution)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// MaskedErrorMessage is the message of the errors masked by MaskErrors.
+const MaskedErrorMessage = "Internal server error"
+
+// SafeError is implemented by the errors whose message can be shown to
+// clients when Config.MaskErrors is enabled.
+type SafeError interface {
+	error
+
+	// Safe reports whether the message of the error can be shown to
+	// clients.
+	Safe() bool
+}
+
+// ErrorFormatter formats each error of the results before they are sent to
+// the client.
+type ErrorFormatter func(ctx context.Context, err gqlerrors.FormattedError) gqlerrors.FormattedError
+
+// ErrorReporter receives the original of each error masked by MaskErrors,
+// along with the correlation ID the client is given.
+type ErrorReporter func(ctx context.Context, correlationID string, err gqlerrors.FormattedError)
+
+// safeError is the SafeError returned by NewSafeError.
+type safeError struct {
+	message string
+}
+
+func (e *safeError) Error() string {
+	return e.message
+}
+
+func (e *safeError) Safe() bool {
+	return true
+}
+
+// NewSafeError returns an error whose message is shown to clients when
+// Config.MaskErrors is enabled.
+func NewSafeError(message string) error {
+	return &safeError{message: message}
+}
+
+// formatErrors completes, masks and formats the errors of result, in place.
+func (h *Handler) formatErrors(ctx context.Context, result *graphql.Result) *graphql.Result {
+	for i, err := range result.Errors {
+		err = completeError(err)
+		if h.maskErrors && isUnexpectedError(err) {
+			err = h.maskError(ctx, err)
+		}
+		if h.errorFormatter != nil {
+			err = h.errorFormatter(ctx, err)
+		}
+		result.Errors[i] = err
+	}
+	return result
+}
+
+// formatSubscriptionErrors completes, masks and formats the errors of each
+// result sent on results.
+func (h *Handler) formatSubscriptionErrors(ctx context.Context, results chan *graphql.Result) chan *graphql.Result {
+	formatted := make(chan *graphql.Result)
+	go func() {
+		defer close(formatted)
+		for result := range results {
+			formatted <- h.formatErrors(ctx, result)
+		}
+	}()
+	return formatted
+}
+
+// isUnexpectedError reports whether err was returned by a resolver without
+// being marked as safe. Syntax, validation and handler errors have no
+// original error.
+func isUnexpectedError(err gqlerrors.FormattedError) bool {
+	original := originalError(err)
+	if original == nil {
+		return false
+	}
+
+	var safe SafeError
+	return !errors.As(original, &safe) || !safe.Safe()
+}
+
+// maskError replaces err with an error carrying a correlation ID, reporting
+// the original to the ErrorReporter.
+func (h *Handler) maskError(ctx context.Context, err gqlerrors.FormattedError) gqlerrors.FormattedError {
+	correlationID := newCorrelationID()
+	if h.errorReporter != nil {
+		h.errorReporter(ctx, correlationID, err)
+	}
+
+	return gqlerrors.FormattedError{
+		Message:   MaskedErrorMessage,
+		Locations: append([]location.SourceLocation{}, err.Locations...),
+		Path:      err.Path,
+		Extensions: map[string]interface{}{
+			"code":          CodeInternalServerError,
+			"correlationId": correlationID,
+		},
+	}
+}
+
+// newCorrelationID returns a random identifier.
+func newCorrelationID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
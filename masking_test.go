@@ -0,0 +1,175 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"strings"
+	"testing"
+)
+
+func newFailingSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"internal": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, errors.New("pq: relation \"users\" does not exist")
+					},
+				},
+				"safe": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, fmt.Errorf("wrapped: %w", handler.NewSafeError("User not found"))
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_MaskErrors(t *testing.T) {
+	var reported []gqlerrors.FormattedError
+	var correlationIDs []string
+	schema := newFailingSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:     &schema,
+		MaskErrors: true,
+		ErrorReporter: func(ctx context.Context, correlationID string, err gqlerrors.FormattedError) {
+			reported = append(reported, err)
+			correlationIDs = append(correlationIDs, correlationID)
+		},
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={internal}", nil))
+	if len(result.Errors) != 1 {
+		t.Fatalf("expected a single error, got %v", result.Errors)
+	}
+	masked := result.Errors[0]
+	if masked.Message != handler.MaskedErrorMessage {
+		t.Fatalf("wrong message, expected %q, got %q", handler.MaskedErrorMessage, masked.Message)
+	}
+	if masked.Extensions["code"] != "INTERNAL_SERVER_ERROR" {
+		t.Fatalf("wrong code, got %v", masked.Extensions["code"])
+	}
+	if len(masked.Path) != 1 || masked.Path[0] != "internal" {
+		t.Fatalf("expected the path to be kept, got %v", masked.Path)
+	}
+
+	if len(reported) != 1 || !strings.Contains(reported[0].Message, "pq: relation") {
+		t.Fatalf("expected the original error to be reported, got %v", reported)
+	}
+	if masked.Extensions["correlationId"] != correlationIDs[0] || correlationIDs[0] == "" {
+		t.Fatalf("expected the reported correlation ID %q, got %v", correlationIDs[0], masked.Extensions["correlationId"])
+	}
+}
+
+func TestHandler_MaskErrorsSafeError(t *testing.T) {
+	schema := newFailingSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:     &schema,
+		MaskErrors: true,
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={safe}", nil))
+	if len(result.Errors) != 1 || result.Errors[0].Message != "wrapped: User not found" {
+		t.Fatalf("expected the safe error to pass through, got %v", result.Errors)
+	}
+
+	result = executeTest(t, h, newHTTPCtx("GET", "/graphql?query={unknown}", nil))
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Message, "unknown") {
+		t.Fatalf("expected validation errors to pass through, got %v", result.Errors)
+	}
+}
+
+func TestHandler_ErrorFormatter(t *testing.T) {
+	schema := newFailingSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:     &schema,
+		MaskErrors: true,
+		ErrorFormatter: func(ctx context.Context, err gqlerrors.FormattedError) gqlerrors.FormattedError {
+			err.Message = "formatted: " + err.Message
+			return err
+		},
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={internal safe}", nil))
+	messages := map[string]bool{}
+	for _, err := range result.Errors {
+		messages[err.Message] = true
+	}
+	if !messages["formatted: "+handler.MaskedErrorMessage] || !messages["formatted: wrapped: User not found"] {
+		t.Fatalf("expected the errors to be masked then formatted, got %v", result.Errors)
+	}
+
+	result = executeTest(t, h, newHTTPCtx("GET", "/graphql?query={", nil))
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Message, "formatted: Syntax Error") {
+		t.Fatalf("expected the errors of rejected operations to be formatted, got %v", result.Errors)
+	}
+}
+
+func TestHandler_ErrorFormatterEveryResult(t *testing.T) {
+	schema := newFailingSchema(t)
+	formatter := func(ctx context.Context, err gqlerrors.FormattedError) gqlerrors.FormattedError {
+		err.Message = "formatted: " + err.Message
+		return err
+	}
+	cases := map[string]struct {
+		config          handler.Config
+		ctx             *fasthttp.RequestCtx
+		expectedMessage string
+	}{
+		"OnResult hook errors": {
+			config: handler.Config{
+				OnResult: func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions, result *graphql.Result) error {
+					return errors.New("pq: connection refused")
+				},
+			},
+			ctx:             newHTTPCtx("GET", "/graphql?query={safe}", nil),
+			expectedMessage: "formatted: " + handler.MaskedErrorMessage,
+		},
+		"middleware results": {
+			config: handler.Config{
+				Middlewares: []handler.Middleware{func(next handler.ExecuteFn) handler.ExecuteFn {
+					return func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) *graphql.Result {
+						return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "forbidden"}}}
+					}
+				}},
+			},
+			ctx:             newHTTPCtx("GET", "/graphql?query={safe}", nil),
+			expectedMessage: "formatted: forbidden",
+		},
+		"oversized bodies": {
+			config:          handler.Config{MaxBodyBytes: 1},
+			ctx:             newHTTPCtx("POST", "/graphql", []byte(`{"query":"{safe}"}`)),
+			expectedMessage: "formatted: Request body exceeds the maximum of 1 bytes",
+		},
+		"malformed bodies": {
+			config:          handler.Config{GraphQLOverHTTP: true},
+			ctx:             newHTTPCtx("POST", "/graphql", []byte(`{`)),
+			expectedMessage: "formatted: malformed request body",
+		},
+	}
+
+	for name, tc := range cases {
+		tc.config.Schema = &schema
+		tc.config.MaskErrors = true
+		tc.config.ErrorFormatter = formatter
+		h := handler.New(&tc.config)
+		tc.ctx.Request.Header.SetContentType("application/json")
+		result := executeTest(t, h, tc.ctx)
+		if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0].Message, tc.expectedMessage) {
+			t.Fatalf("%s: expected a %q error, got %v", name, tc.expectedMessage, result.Errors)
+		}
+	}
+}
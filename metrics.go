@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentTypePrometheus is the media type of the Prometheus text exposition
+// format.
+const ContentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultMetricsBuckets are the upper bounds, in seconds, of the buckets of
+// the operation duration histogram when NewMetrics is given none.
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultMetricsMaxSeries is the number of distinct operation names and
+// types a Metrics created by NewMetrics keeps series for.
+const DefaultMetricsMaxSeries = 1000
+
+// OtherOperationsName is the operation name of the series recording the
+// operations observed once a Metrics holds MaxSeries series.
+const OtherOperationsName = "__other__"
+
+// OperationMetrics describes an operation once it is answered.
+type OperationMetrics struct {
+	// Name is the name of the operation and Type its type, which are empty
+	// when the operation was rejected before being identified. The name is
+	// empty for anonymous operations.
+	Name string
+	Type string
+
+	Duration time.Duration
+	Errors   int
+}
+
+// MetricsCollector records the metrics of a Handler. Subscriptions are not
+// observed.
+type MetricsCollector interface {
+	// ObserveOperation is called once each operation is answered, including
+	// the operations rejected before their execution and the requests
+	// rejected before their operations are parsed, which have no name nor
+	// type.
+	ObserveOperation(m OperationMetrics)
+
+	// ObserveParseFailure is called for each document failing to parse.
+	ObserveParseFailure()
+
+	// ObserveValidationFailure is called for each document failing to
+	// validate.
+	ObserveValidationFailure()
+}
+
+// PrometheusWriter is implemented by the metrics collectors able to write
+// their metrics in the Prometheus text exposition format.
+type PrometheusWriter interface {
+	WritePrometheus(w io.Writer) error
+}
+
+// Metrics is an in-memory MetricsCollector, exposed in the Prometheus text
+// exposition format by Handler.ServeMetrics.
+type Metrics struct {
+	// parseFailures and validationFailures are first so they are 64-bit
+	// aligned for atomic access
+	parseFailures      uint64
+	validationFailures uint64
+
+	buckets []float64
+
+	// MaxSeries caps the number of series of the operation metrics, which
+	// are labeled by operation name and type. Operations observed once it is
+	// reached are recorded under OtherOperationsName. Zero disables the cap.
+	// It must be set before the metrics are used.
+	MaxSeries int
+
+	mu         sync.Mutex
+	operations map[operationLabels]*operationSeries
+}
+
+var (
+	_ MetricsCollector = &Metrics{}
+	_ PrometheusWriter = &Metrics{}
+)
+
+// operationLabels are the labels of the operation metrics.
+type operationLabels struct {
+	name          string
+	operationType string
+}
+
+// operationSeries holds the metrics of the operations sharing the same labels.
+type operationSeries struct {
+	count        uint64
+	errors       uint64
+	bucketCounts []uint64
+	sum          float64
+}
+
+// NewMetrics creates a Metrics whose duration histogram has the given bucket
+// upper bounds, in seconds, or DefaultMetricsBuckets.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		buckets:    buckets,
+		MaxSeries:  DefaultMetricsMaxSeries,
+		operations: map[operationLabels]*operationSeries{},
+	}
+}
+
+// ObserveOperation records the count, errors and duration of an operation.
+func (m *Metrics) ObserveOperation(op OperationMetrics) {
+	labels := operationLabels{name: op.Name, operationType: op.Type}
+	seconds := op.Duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.operations[labels]
+	if !ok && m.MaxSeries > 0 && len(m.operations) >= m.MaxSeries {
+		labels = operationLabels{name: OtherOperationsName}
+		series, ok = m.operations[labels]
+	}
+	if !ok {
+		series = &operationSeries{bucketCounts: make([]uint64, len(m.buckets))}
+		m.operations[labels] = series
+	}
+	series.count++
+	series.errors += uint64(op.Errors)
+	series.sum += seconds
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			series.bucketCounts[i]++
+		}
+	}
+}
+
+// ObserveParseFailure counts a document failing to parse.
+func (m *Metrics) ObserveParseFailure() {
+	atomic.AddUint64(&m.parseFailures, 1)
+}
+
+// ObserveValidationFailure counts a document failing to validate.
+func (m *Metrics) ObserveValidationFailure() {
+	atomic.AddUint64(&m.validationFailures, 1)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	m.mu.Lock()
+	labels := make([]operationLabels, 0, len(m.operations))
+	for l := range m.operations {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].name != labels[j].name {
+			return labels[i].name < labels[j].name
+		}
+		return labels[i].operationType < labels[j].operationType
+	})
+
+	writeMetricHeader(bw, "graphql_operations_total", "counter", "Number of GraphQL operations answered.")
+	for _, l := range labels {
+		fmt.Fprintf(bw, "graphql_operations_total{%s} %d\n", l.format(), m.operations[l].count)
+	}
+
+	writeMetricHeader(bw, "graphql_operation_errors_total", "counter", "Number of errors returned by GraphQL operations.")
+	for _, l := range labels {
+		fmt.Fprintf(bw, "graphql_operation_errors_total{%s} %d\n", l.format(), m.operations[l].errors)
+	}
+
+	writeMetricHeader(bw, "graphql_operation_duration_seconds", "histogram", "Duration of GraphQL operations, from their parsing to their result.")
+	for _, l := range labels {
+		series := m.operations[l]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(bw, "graphql_operation_duration_seconds_bucket{%s,le=\"%s\"} %d\n", l.format(), formatFloat(bound), series.bucketCounts[i])
+		}
+		fmt.Fprintf(bw, "graphql_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l.format(), series.count)
+		fmt.Fprintf(bw, "graphql_operation_duration_seconds_sum{%s} %s\n", l.format(), formatFloat(series.sum))
+		fmt.Fprintf(bw, "graphql_operation_duration_seconds_count{%s} %d\n", l.format(), series.count)
+	}
+	m.mu.Unlock()
+
+	writeMetricHeader(bw, "graphql_parse_failures_total", "counter", "Number of GraphQL documents failing to parse.")
+	fmt.Fprintf(bw, "graphql_parse_failures_total %d\n", atomic.LoadUint64(&m.parseFailures))
+
+	writeMetricHeader(bw, "graphql_validation_failures_total", "counter", "Number of GraphQL documents failing to validate.")
+	fmt.Fprintf(bw, "graphql_validation_failures_total %d\n", atomic.LoadUint64(&m.validationFailures))
+
+	return bw.Flush()
+}
+
+// format formats the labels of a series.
+func (l operationLabels) format() string {
+	return fmt.Sprintf("operation_name=\"%s\",operation_type=\"%s\"", escapeLabelValue(l.name), escapeLabelValue(l.operationType))
+}
+
+// escapeLabelValue escapes a label value of the Prometheus text exposition
+// format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// ServeMetrics writes the metrics of the handler in the Prometheus text
+// exposition format: those of Config.Metrics, when it implements
+// PrometheusWriter, along with the document cache statistics.
+func (h *Handler) ServeMetrics(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType(ContentTypePrometheus)
+
+	if writer, ok := h.metrics.(PrometheusWriter); ok {
+		if err := writer.WritePrometheus(ctx); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+	}
+
+	stats := h.DocumentCacheStats()
+	writeMetricHeader(ctx, "graphql_document_cache_hits_total", "counter", "Number of GraphQL documents found in the document cache.")
+	fmt.Fprintf(ctx, "graphql_document_cache_hits_total %d\n", stats.Hits)
+	writeMetricHeader(ctx, "graphql_document_cache_misses_total", "counter", "Number of GraphQL documents missing from the document cache.")
+	fmt.Fprintf(ctx, "graphql_document_cache_misses_total %d\n", stats.Misses)
+	writeMetricHeader(ctx, "graphql_document_cache_size", "gauge", "Number of GraphQL documents in the document cache.")
+	fmt.Fprintf(ctx, "graphql_document_cache_size %d\n", stats.Size)
+}
+
+// observeOperation reports an answered operation to the metrics collector.
+func (h *Handler) observeOperation(r *operationReport) {
+	if h.metrics == nil {
+		return
+	}
+
+	h.metrics.ObserveOperation(OperationMetrics{
+		Name:     r.name(),
+		Type:     r.operationType(),
+		Duration: r.duration,
+		Errors:   len(r.result.Errors),
+	})
+}
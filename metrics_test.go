@@ -0,0 +1,127 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_Metrics(t *testing.T) {
+	metrics := handler.NewMetrics()
+	h := handler.New(&handler.Config{
+		Schema:  &testutil.StarWarsSchema,
+		Metrics: metrics,
+	})
+
+	for _, query := range []string{
+		"query+HeroName{hero{name}}",
+		"query+HeroName{hero{name}}",
+		"{hero{unknown}}",
+		"{hero{",
+	} {
+		h.ServeHTTP(newHTTPCtx("GET", "/graphql?query="+query, nil))
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	h.ServeMetrics(ctx)
+	if contentType := string(ctx.Response.Header.ContentType()); contentType != handler.ContentTypePrometheus {
+		t.Fatalf("wrong content type, expected %q, got %q", handler.ContentTypePrometheus, contentType)
+	}
+
+	body := string(ctx.Response.Body())
+	for _, line := range []string{
+		`graphql_operations_total{operation_name="HeroName",operation_type="query"} 2`,
+		`graphql_operation_errors_total{operation_name="HeroName",operation_type="query"} 0`,
+		`graphql_operation_duration_seconds_bucket{operation_name="HeroName",operation_type="query",le="+Inf"} 2`,
+		`graphql_operation_duration_seconds_count{operation_name="HeroName",operation_type="query"} 2`,
+		`graphql_operations_total{operation_name="",operation_type="query"} 1`,
+		`graphql_operation_errors_total{operation_name="",operation_type="query"} 1`,
+		`graphql_operations_total{operation_name="",operation_type=""} 1`,
+		`graphql_parse_failures_total 1`,
+		`graphql_validation_failures_total 1`,
+		`graphql_document_cache_hits_total 1`,
+		`graphql_document_cache_misses_total 3`,
+		`graphql_document_cache_size 1`,
+		`# TYPE graphql_operation_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("expected %q in the metrics, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_Histogram(t *testing.T) {
+	metrics := handler.NewMetrics(1, 0.1)
+	metrics.ObserveOperation(handler.OperationMetrics{Name: "a\"b", Type: "query", Duration: 50 * time.Millisecond, Errors: 1})
+	metrics.ObserveOperation(handler.OperationMetrics{Name: "a\"b", Type: "query", Duration: 500 * time.Millisecond})
+
+	var body strings.Builder
+	if err := metrics.WritePrometheus(&body); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`graphql_operation_duration_seconds_bucket{operation_name="a\"b",operation_type="query",le="0.1"} 1`,
+		`graphql_operation_duration_seconds_bucket{operation_name="a\"b",operation_type="query",le="1"} 2`,
+		`graphql_operation_duration_seconds_sum{operation_name="a\"b",operation_type="query"} 0.55`,
+		`graphql_operation_errors_total{operation_name="a\"b",operation_type="query"} 1`,
+	} {
+		if !strings.Contains(body.String(), line+"\n") {
+			t.Fatalf("expected %q in the metrics, got:\n%s", line, body.String())
+		}
+	}
+}
+
+func TestHandler_MetricsOperationNames(t *testing.T) {
+	metrics := handler.NewMetrics()
+	h := handler.New(&handler.Config{
+		Schema:  &testutil.StarWarsSchema,
+		Metrics: metrics,
+	})
+
+	for _, u := range []string{
+		"/graphql?query=%7B&operationName=junk1",
+		"/graphql?query=%7B&operationName=junk2",
+		"/graphql?query=query+HeroName{hero{name}}&operationName=junk3",
+	} {
+		h.ServeHTTP(newHTTPCtx("GET", u, nil))
+	}
+
+	var body strings.Builder
+	if err := metrics.WritePrometheus(&body); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body.String(), "junk") {
+		t.Fatalf("expected the operation names of the requests not to be used, got:\n%s", body.String())
+	}
+	if !strings.Contains(body.String(), `graphql_operations_total{operation_name="",operation_type=""} 3`+"\n") {
+		t.Fatalf("expected the rejected operations to share a series, got:\n%s", body.String())
+	}
+}
+
+func TestMetrics_MaxSeries(t *testing.T) {
+	metrics := handler.NewMetrics()
+	metrics.MaxSeries = 2
+	for _, name := range []string{"A", "B", "C", "D", "A"} {
+		metrics.ObserveOperation(handler.OperationMetrics{Name: name, Type: "query"})
+	}
+
+	var body strings.Builder
+	if err := metrics.WritePrometheus(&body); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`graphql_operations_total{operation_name="A",operation_type="query"} 2`,
+		`graphql_operations_total{operation_name="B",operation_type="query"} 1`,
+		`graphql_operations_total{operation_name="__other__",operation_type=""} 2`,
+	} {
+		if !strings.Contains(body.String(), line+"\n") {
+			t.Fatalf("expected %q in the metrics, got:\n%s", line, body.String())
+		}
+	}
+	if strings.Contains(body.String(), `operation_name="C"`) {
+		t.Fatalf("expected no series past the maximum, got:\n%s", body.String())
+	}
+}
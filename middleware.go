@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/valyala/fasthttp"
+	"net/http"
+)
+
+// ExecuteFn executes the operation described by opts and returns its result.
+type ExecuteFn func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result
+
+// Middleware wraps the execution of operations, e.g. to authenticate, log or
+// cache them. It returns an ExecuteFn that usually calls next, possibly with
+// a derived context or altered options, and may inspect or replace the
+// result. Returning a result without calling next short-circuits the
+// execution. The results of subscriptions are streamed once the middlewares
+// return, so next returns an empty result for them and the context passed to
+// next must outlive the middleware.
+type Middleware func(next ExecuteFn) ExecuteFn
+
+// executeWithMiddlewares runs a single operation through the middlewares and
+// returns its result along with the HTTP status code it should be answered
+// with. Results of middlewares short-circuiting the execution are answered
+// with a 200 status code.
+func (h *Handler) executeWithMiddlewares(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) (*graphql.Result, int) {
+	if len(h.middlewares) == 0 {
+		return h.executeRequest(ctx, ctxreq, opts)
+	}
+
+	status := http.StatusOK
+	next := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result {
+		var result *graphql.Result
+		result, status = h.executeRequest(ctx, ctxreq, opts)
+		return result
+	}
+	return h.runMiddlewares(ctx, ctxreq, opts, next), status
+}
+
+// runMiddlewares runs next through the middlewares, the first middleware
+// being the outermost one. The errors of results returned by the middlewares
+// instead of the one of next are formatted, as next formats its own.
+func (h *Handler) runMiddlewares(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, next ExecuteFn) *graphql.Result {
+	var executed *graphql.Result
+	fn := ExecuteFn(func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result {
+		executed = next(ctx, ctxreq, opts)
+		return executed
+	})
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		fn = h.middlewares[i](fn)
+	}
+
+	result := fn(ctx, ctxreq, opts)
+	if result != nil && result != executed {
+		h.formatErrors(ctx, result)
+	}
+	return result
+}
@@ -0,0 +1,142 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandler_Middlewares(t *testing.T) {
+	schema := newCountdownSchema(t)
+
+	var calls []string
+	trace := func(name string) handler.Middleware {
+		return func(next handler.ExecuteFn) handler.ExecuteFn {
+			return func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) *graphql.Result {
+				calls = append(calls, name+" before")
+				result := next(ctx, ctxreq, opts)
+				calls = append(calls, name+" after")
+				return result
+			}
+		}
+	}
+	auth := func(next handler.ExecuteFn) handler.ExecuteFn {
+		return func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) *graphql.Result {
+			user := string(ctxreq.Request.Header.Peek("X-User"))
+			if user == "" {
+				return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "unauthenticated"}}}
+			}
+			result := next(context.WithValue(ctx, "user", user), ctxreq, opts)
+			result.Extensions = map[string]interface{}{"user": user}
+			return result
+		}
+	}
+	h := handler.New(&handler.Config{
+		Schema:      &schema,
+		Middlewares: []handler.Middleware{trace("outer"), auth, trace("inner")},
+	})
+
+	ctx := newHTTPCtx("GET", "/graphql?query={user}", nil)
+	ctx.Request.Header.Set("X-User", "luke")
+	result := executeTest(t, h, ctx)
+	expected := &graphql.Result{
+		Data:       map[string]interface{}{"user": "luke"},
+		Extensions: map[string]interface{}{"user": "luke"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, expected %v, got %v", expected, result)
+	}
+	expectedCalls := []string{"outer before", "inner before", "inner after", "outer after"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("wrong calls, expected %v, got %v", expectedCalls, calls)
+	}
+
+	calls = nil
+	result = executeTest(t, h, newHTTPCtx("GET", "/graphql?query={user}", nil))
+	if len(result.Errors) != 1 || result.Errors[0].Message != "unauthenticated" || result.Data != nil {
+		t.Fatalf("expected the middleware result, got %v", result)
+	}
+	expectedCalls = []string{"outer before", "outer after"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("wrong calls, expected %v, got %v", expectedCalls, calls)
+	}
+}
+
+func TestHandler_MiddlewaresStreamed(t *testing.T) {
+	deny := func(next handler.ExecuteFn) handler.ExecuteFn {
+		return func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) *graphql.Result {
+			return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: "forbidden"}}}
+		}
+	}
+
+	for name, accept := range map[string]string{
+		"json":             "application/json",
+		"event stream":     "text/event-stream",
+		"incremental":      "multipart/mixed; deferSpec=20220824",
+		"incremental json": "multipart/mixed; deferSpec=20220824, application/json",
+	} {
+		var counter int
+		schema := newCounterSchema(t, &counter)
+		h := handler.New(&handler.Config{Schema: &schema, Middlewares: []handler.Middleware{deny}})
+
+		ctx := newHTTPCtx("POST", "/graphql", []byte(`{"query":"mutation{increment}"}`))
+		ctx.Request.Header.SetContentType("application/json")
+		ctx.Request.Header.Set("Accept", accept)
+		result := executeTest(t, h, ctx)
+		if counter != 0 {
+			t.Fatalf("%s: the middleware was bypassed", name)
+		}
+		if len(result.Errors) != 1 || result.Errors[0].Message != "forbidden" {
+			t.Fatalf("%s: expected the middleware result, got %v", name, result)
+		}
+	}
+
+	var counter int
+	schema := newCounterSchema(t, &counter)
+	h := handler.New(&handler.Config{Schema: &schema, Middlewares: []handler.Middleware{deny}})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	readWebSocketMessage(t, conn)
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{
+		"query": "mutation { increment }",
+	}})
+	msg := readWebSocketMessage(t, conn)
+	payload, _ := json.Marshal(msg.Payload)
+	if msg.Type != "next" || !strings.Contains(string(payload), `"message":"forbidden"`) {
+		t.Fatalf("expected the middleware result, got %v", msg)
+	}
+	if msg := readWebSocketMessage(t, conn); msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+	if counter != 0 {
+		t.Fatal("the middleware was bypassed over WebSocket")
+	}
+}
+
+func TestHandler_MiddlewaresSubscription(t *testing.T) {
+	schema := newCountdownSchema(t)
+	var calls int
+	count := func(next handler.ExecuteFn) handler.ExecuteFn {
+		return func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) *graphql.Result {
+			calls++
+			return next(ctx, ctxreq, opts)
+		}
+	}
+	h := handler.New(&handler.Config{Schema: &schema, Middlewares: []handler.Middleware{count}})
+	resp := serveEventStreamTest(t, h, "/graphql?query=subscription{countdown(from:2)}")
+
+	expected := []string{
+		"event: next\ndata: {\"data\":{\"countdown\":2}}",
+		"event: next\ndata: {\"data\":{\"countdown\":1}}",
+		"event: complete\ndata:",
+	}
+	if events := readEvents(t, resp); !reflect.DeepEqual(events, expected) || calls != 1 {
+		t.Fatalf("wrong events or calls, expected %q, got %q (%d calls)", expected, events, calls)
+	}
+}
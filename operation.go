@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"time"
+)
+
+// operation is a GraphQL operation that passed the checks of the handler and
+// is ready to be executed.
+type operation struct {
+	opts       *RequestOptions
+	doc        *ast.Document
+	definition *ast.OperationDefinition
+	complexity int
+
+	// trace records the timings of the operation when Tracing is enabled.
+	trace *trace
+
+	// start is when the handling of the operation started.
+	start time.Time
+
+	// status is the HTTP status code the operation is answered with once
+	// executed.
+	status int
+}
+
+// prepareOperation resolves, parses and checks a single operation. It returns
+// a non-nil result, along with the HTTP status code it should be answered
+// with, when the operation is rejected.
+func (h *Handler) prepareOperation(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) (op *operation, result *graphql.Result, status int) {
+	start := time.Now()
+	var definition *ast.OperationDefinition
+	defer func() {
+		if result != nil {
+			h.formatErrors(ctx, result)
+			h.reportOperation(&operationReport{
+				opts:       opts,
+				definition: definition,
+				duration:   time.Since(start),
+				result:     result,
+				status:     status,
+			})
+		}
+	}()
+
+	if h.onRequest != nil {
+		unlock := lockRequest(ctx)
+		err := h.onRequest(ctx, ctxreq, opts)
+		unlock()
+		if err != nil {
+			return nil, newHookErrorResult(err), h.requestErrorStatus()
+		}
+	}
+
+	if result, status := h.resolvePersistedOperation(opts); result != nil {
+		return nil, result, status
+	}
+
+	if !h.persistedOperationsOnly {
+		if result := h.resolvePersistedQuery(ctx, opts); result != nil {
+			return nil, result, h.requestErrorStatus()
+		}
+	}
+
+	var tr *trace
+	if h.tracing || (h.logger != nil && h.slowOperationThreshold > 0) {
+		tr = newTrace()
+	}
+
+	// parse and validate the query, or fetch it from the document cache
+	parsingStart := time.Now()
+	doc, key := h.lookupDocument(opts.Query)
+	cached := doc != nil
+	if !cached {
+		if result := h.checkQueryLimits(opts.Query); result != nil {
+			return nil, result, http.StatusBadRequest
+		}
+
+		_, span := h.startSpan(ctx, SpanParse)
+		var errs []gqlerrors.FormattedError
+		doc, errs = h.parseDocument(opts.Query)
+		endSpan(span, errs)
+		if errs != nil {
+			if h.metrics != nil {
+				h.metrics.ObserveParseFailure()
+			}
+			return nil, &graphql.Result{Errors: setErrorCode(errs, CodeParseFailed)}, h.requestErrorStatus()
+		}
+		if tr != nil {
+			tr.parsing = tr.phase(parsingStart)
+		}
+	}
+	definition = getOperation(doc, opts.OperationName)
+
+	// reject oversized documents before the validation, whose cost grows
+	// with the number of fields
+	if result := h.checkDocumentLimits(doc, definition); result != nil {
+		return nil, result, http.StatusBadRequest
+	}
+
+	if h.onParsed != nil {
+		unlock := lockRequest(ctx)
+		err := h.onParsed(ctx, ctxreq, opts, doc)
+		unlock()
+		if err != nil {
+			return nil, newHookErrorResult(err), h.requestErrorStatus()
+		}
+	}
+
+	if !cached {
+		validationStart := time.Now()
+		_, span := h.startSpan(ctx, SpanValidate)
+		errs := h.validateDocument(doc, key)
+		endSpan(span, errs)
+		if errs != nil {
+			if h.metrics != nil {
+				h.metrics.ObserveValidationFailure()
+			}
+			return nil, &graphql.Result{Errors: setErrorCode(errs, CodeValidationFailed)}, h.requestErrorStatus()
+		}
+		if tr != nil {
+			tr.validation = tr.phase(validationStart)
+		}
+	}
+
+	if h.onValidated != nil {
+		unlock := lockRequest(ctx)
+		err := h.onValidated(ctx, ctxreq, opts, doc)
+		unlock()
+		if err != nil {
+			return nil, newHookErrorResult(err), h.requestErrorStatus()
+		}
+	}
+
+	op = &operation{
+		opts:       opts,
+		doc:        doc,
+		definition: definition,
+		complexity: -1,
+		trace:      tr,
+		start:      start,
+	}
+	setOperationAttributes(ctx, opts, op.definition)
+
+	if op.definition == nil {
+		// let the executor report the missing operation
+		return op, nil, http.StatusOK
+	}
+
+	if !h.introspectionAllowed(ctxreq) && selectsIntrospection(doc, op.definition) {
+		return nil, newErrorResult("GraphQL introspection is not allowed", CodeIntrospectionDisabled), h.requestErrorStatus()
+	}
+
+	// reject over-deep operations before invoking any resolver
+	if h.maxDepth > 0 {
+		if depth := operationDepth(doc, op.definition); depth > h.maxDepth {
+			message := fmt.Sprintf("Operation has a depth of %d, which exceeds the maximum depth of %d", depth, h.maxDepth)
+			return nil, newErrorResult(message, CodeDepthLimitExceeded), h.requestErrorStatus()
+		}
+	}
+
+	// reject over-budget operations before invoking any resolver
+	if h.maxComplexity > 0 || h.reportComplexity {
+		op.complexity = operationComplexity(h.Schema, h.fieldCosts, doc, op.definition, opts.Variables)
+		if h.maxComplexity > 0 && op.complexity > h.maxComplexity {
+			message := fmt.Sprintf("Operation has a complexity of %d, which exceeds the maximum complexity of %d", op.complexity, h.maxComplexity)
+			result := newErrorResult(message, CodeComplexityLimitExceeded)
+			h.addComplexityExtension(result, op.complexity)
+			return nil, result, h.requestErrorStatus()
+		}
+	}
+
+	return op, nil, http.StatusOK
+}
+
+// executeOperation executes a prepared operation.
+func (h *Handler) executeOperation(ctx context.Context, ctxreq *fasthttp.RequestCtx, op *operation) *graphql.Result {
+	if op.trace != nil {
+		ctx = withTrace(ctx, op.trace)
+	}
+
+	ctx, span := h.startSpan(ctx, SpanExecute)
+	executionStart := time.Now()
+	result := graphql.Execute(h.newExecuteParams(ctx, ctxreq, op.opts, op.doc))
+	execution := time.Since(executionStart)
+	endSpan(span, result.Errors)
+
+	op.status = http.StatusOK
+	if ctx.Err() == context.DeadlineExceeded {
+		result, op.status = newTimeoutResult(), h.timeoutStatus
+	} else if isRequestError(result) {
+		op.status = h.requestErrorStatus()
+	}
+	h.addComplexityExtension(result, op.complexity)
+
+	if h.onExecuted != nil {
+		unlock := lockRequest(ctx)
+		err := h.onExecuted(ctx, ctxreq, op.opts, result)
+		unlock()
+		if err != nil {
+			result = newHookErrorResult(err)
+		}
+	}
+	h.formatErrors(ctx, result)
+
+	h.reportOperation(&operationReport{
+		opts:       op.opts,
+		definition: op.definition,
+		trace:      op.trace,
+		duration:   time.Since(op.start),
+		execution:  execution,
+		result:     result,
+		status:     op.status,
+	})
+	return result
+}
+
+// operationReport describes an answered operation to the metrics collector
+// and the logger.
+type operationReport struct {
+	opts       *RequestOptions
+	definition *ast.OperationDefinition
+
+	// trace holds the parsing and validation timings, when recorded.
+	trace     *trace
+	duration  time.Duration
+	execution time.Duration
+
+	result *graphql.Result
+	status int
+}
+
+// name returns the name of the operation, if any. The operation name of the
+// request is only used once it matches an operation of the document, so
+// clients can't make up names.
+func (r *operationReport) name() string {
+	if r.definition != nil && r.definition.Name != nil {
+		return r.definition.Name.Value
+	}
+	return ""
+}
+
+// operationType returns the type of the operation, or an empty string when
+// it was rejected before being identified.
+func (r *operationReport) operationType() string {
+	if r.definition != nil {
+		return r.definition.Operation
+	}
+	return ""
+}
+
+// reportRejection reports an operation, or a request, rejected outside of
+// prepareOperation. The options are nil when the request was rejected before
+// they were parsed.
+func (h *Handler) reportRejection(opts *RequestOptions, definition *ast.OperationDefinition, start time.Time, result *graphql.Result, status int) {
+	if opts == nil {
+		opts = &RequestOptions{}
+	}
+	h.reportOperation(&operationReport{
+		opts:       opts,
+		definition: definition,
+		duration:   time.Since(start),
+		result:     result,
+		status:     status,
+	})
+}
+
+// reportOperation reports an answered operation to the metrics collector and
+// the logger.
+func (h *Handler) reportOperation(r *operationReport) {
+	h.observeOperation(r)
+	h.logOperation(r)
+}
+
+// subscribeOperation executes a prepared subscription operation, returning
+// the channel of its results.
+func (h *Handler) subscribeOperation(ctx context.Context, ctxreq *fasthttp.RequestCtx, op *operation) chan *graphql.Result {
+	return h.formatSubscriptionErrors(ctx, graphql.ExecuteSubscription(h.newExecuteParams(ctx, ctxreq, op.opts, op.doc)))
+}
+
+// addComplexityExtension reports the complexity of the operation in the
+// extensions of result when ReportComplexity is enabled.
+func (h *Handler) addComplexityExtension(result *graphql.Result, complexity int) {
+	if !h.reportComplexity || complexity < 0 {
+		return
+	}
+
+	report := map[string]interface{}{"cost": complexity}
+	if h.maxComplexity > 0 {
+		report["maximum"] = h.maxComplexity
+	}
+	if result.Extensions == nil {
+		result.Extensions = map[string]interface{}{}
+	}
+	result.Extensions["complexity"] = report
+}
+
+// newExecuteParams builds the graphql.ExecuteParams used to execute a single
+// operation.
+func (h *Handler) newExecuteParams(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions, doc *ast.Document) graphql.ExecuteParams {
+	schema := h.Schema
+	if h.executionSchema != nil {
+		schema = h.executionSchema
+	}
+
+	params := graphql.ExecuteParams{
+		Schema:        *schema,
+		AST:           doc,
+		Args:          opts.Variables,
+		OperationName: opts.OperationName,
+		Context:       ctx,
+	}
+	if h.rootObjectFn != nil {
+		params.Root = h.rootObjectFn(ctx, &ctxreq.Request)
+	}
+	return params
+}
+
+// newExecutionSchema returns a copy of schema instrumented with the
+// extensions of the handler, leaving the schema of the Config untouched.
+func newExecutionSchema(schema *graphql.Schema, extensions []graphql.Extension) *graphql.Schema {
+	executionSchema := *schema
+	executionSchema.AddExtensions(extensions...)
+	return &executionSchema
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"io/ioutil"
+	"net/http"
+)
+
+// LoadPersistedOperations reads a persisted operations manifest, a JSON object
+// mapping each operation id to its GraphQL document.
+func LoadPersistedOperations(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations map[string]string
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("invalid persisted operations manifest %s: %v", path, err)
+	}
+	return operations, nil
+}
+
+// operationID returns the persisted operation referenced by the request, if
+// any.
+func (opts *RequestOptions) operationID() string {
+	if opts.DocumentID != "" {
+		return opts.DocumentID
+	}
+	return opts.ID
+}
+
+// resolvePersistedOperation replaces an `id` or `documentId` reference with
+// the stored document. When only persisted operations are allowed, requests
+// carrying anything else are rejected. It returns a non-nil result when the
+// request must be answered with an error.
+func (h *Handler) resolvePersistedOperation(opts *RequestOptions) (*graphql.Result, int) {
+	id := opts.operationID()
+	if id == "" {
+		if h.persistedOperationsOnly {
+			return newErrorResult("Only persisted operations are allowed", CodePersistedOperationRequired), http.StatusBadRequest
+		}
+		return nil, http.StatusOK
+	}
+
+	query, ok := h.persistedOperations[id]
+	if !ok {
+		return newErrorResult("PersistedOperationNotFound", CodePersistedOperationNotFound), http.StatusBadRequest
+	}
+	if opts.Query != "" && opts.Query != query {
+		return newErrorResult("Query does not match the persisted operation", CodePersistedOperationMismatch), http.StatusBadRequest
+	}
+	opts.Query = query
+	return nil, http.StatusOK
+}
@@ -0,0 +1,103 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPersistedOperations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operations.json")
+	err := ioutil.WriteFile(path, []byte(`{"hero": "{ hero { name } }"}`), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operations, err := handler.LoadPersistedOperations(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := map[string]string{"hero": "{ hero { name } }"}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Fatalf("wrong operations, expected %v, got %v", expected, operations)
+	}
+}
+
+func TestHandler_PersistedOperationsOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operations.json")
+	err := ioutil.WriteFile(path, []byte(`{"hero": "{ hero { name } }"}`), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handler.New(&handler.Config{
+		Schema:                  &testutil.StarWarsSchema,
+		PersistedOperationsFile: path,
+		PersistedOperationsOnly: true,
+	})
+
+	cases := map[string]struct {
+		body               string
+		expectedStatusCode int
+		expectedErrorCode  string
+	}{
+		"resolves id": {
+			body:               `{"id": "hero"}`,
+			expectedStatusCode: http.StatusOK,
+		},
+		"resolves documentId": {
+			body:               `{"documentId": "hero"}`,
+			expectedStatusCode: http.StatusOK,
+		},
+		"rejects raw query": {
+			body:               `{"query": "{ hero { name } }"}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  "PERSISTED_OPERATION_REQUIRED",
+		},
+		"rejects unknown id": {
+			body:               `{"id": "villain"}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedErrorCode:  "PERSISTED_OPERATION_NOT_FOUND",
+		},
+	}
+
+	for tcID, tc := range cases {
+		t.Run(tcID, func(t *testing.T) {
+			httpCtx := newHTTPCtx("POST", "/graphql", []byte(tc.body))
+			httpCtx.Request.Header.SetContentType("application/json")
+			result := executeTest(t, h, httpCtx)
+
+			if httpCtx.Response.StatusCode() != tc.expectedStatusCode {
+				t.Fatalf("wrong status code, expected %v, got %v", tc.expectedStatusCode, httpCtx.Response.StatusCode())
+			}
+			if tc.expectedErrorCode == "" {
+				expected := map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}
+				if result.HasErrors() || !reflect.DeepEqual(result.Data, expected) {
+					t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result.Data))
+				}
+				return
+			}
+			if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != tc.expectedErrorCode {
+				t.Fatalf("expected a %s error, got %v", tc.expectedErrorCode, result.Errors)
+			}
+		})
+	}
+}
+
+func TestHandler_PersistedOperations_GET(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema:              &testutil.StarWarsSchema,
+		PersistedOperations: map[string]string{"hero": "{ hero { name } }"},
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?id=hero", nil))
+	expected := map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}
+	if result.HasErrors() || !reflect.DeepEqual(result.Data, expected) {
+		t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result.Data))
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"strings"
+)
+
+// DefaultPersistedQueryCacheSize is the number of documents kept by the
+// in-memory store used when Config.PersistedQueryStore is not set.
+const DefaultPersistedQueryCacheSize = 1000
+
+// PersistedQueryStore stores the documents of automatic persisted queries,
+// keyed by the hex encoded SHA-256 hash of the document.
+type PersistedQueryStore interface {
+	// Get returns the document stored for hash.
+	Get(ctx context.Context, hash string) (string, bool)
+
+	// Put stores the document for hash.
+	Put(ctx context.Context, hash string, query string)
+}
+
+// lruPersistedQueryStore is the in-memory PersistedQueryStore.
+type lruPersistedQueryStore struct {
+	cache *lruCache
+}
+
+// NewLRUPersistedQueryStore returns an in-memory PersistedQueryStore that
+// keeps up to size documents, evicting the least recently used ones.
+func NewLRUPersistedQueryStore(size int) PersistedQueryStore {
+	return &lruPersistedQueryStore{
+		cache: newLRUCache(size),
+	}
+}
+
+func (s *lruPersistedQueryStore) Get(ctx context.Context, hash string) (string, bool) {
+	query, ok := s.cache.Get(hash)
+	if !ok {
+		return "", false
+	}
+	return query.(string), true
+}
+
+func (s *lruPersistedQueryStore) Put(ctx context.Context, hash string, query string) {
+	s.cache.Add(hash, query)
+}
+
+// persistedQueryExtension is the `extensions.persistedQuery` entry of an
+// automatic persisted query request.
+type persistedQueryExtension struct {
+	Version    float64
+	Sha256Hash string
+}
+
+func getPersistedQueryExtension(opts *RequestOptions) *persistedQueryExtension {
+	ext, ok := opts.Extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	pq := &persistedQueryExtension{}
+	pq.Version, _ = ext["version"].(float64)
+	pq.Sha256Hash, _ = ext["sha256Hash"].(string)
+	return pq
+}
+
+// resolvePersistedQuery implements the automatic persisted queries handshake.
+// A request carrying only the hash gets its query filled from the store, a
+// request carrying both the hash and the query registers the query. It returns
+// a non-nil result when the request must be answered with an error.
+func (h *Handler) resolvePersistedQuery(ctx context.Context, opts *RequestOptions) *graphql.Result {
+	pq := getPersistedQueryExtension(opts)
+	if pq == nil {
+		return nil
+	}
+
+	if pq.Version != 1 {
+		return newErrorResult("Unsupported persisted query version", CodePersistedQueryNotSupported)
+	}
+
+	hash := strings.ToLower(pq.Sha256Hash)
+	if opts.Query == "" {
+		query, ok := h.persistedQueryStore.Get(ctx, hash)
+		if !ok {
+			return newErrorResult("PersistedQueryNotFound", CodePersistedQueryNotFound)
+		}
+		opts.Query = query
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(opts.Query))
+	if hex.EncodeToString(sum[:]) != hash {
+		return newErrorResult("provided sha does not match query", CodePersistedQueryHashMismatch)
+	}
+	h.persistedQueryStore.Put(ctx, hash, opts.Query)
+	return nil
+}
+
+// newErrorResult returns a result holding a single error with the given code
+// in its extensions.
+func newErrorResult(message string, code string) *graphql.Result {
+	return &graphql.Result{
+		Errors: []gqlerrors.FormattedError{{
+			Message:    message,
+			Locations:  []location.SourceLocation{},
+			Extensions: map[string]interface{}{"code": code},
+		}},
+	}
+}
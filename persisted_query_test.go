@@ -0,0 +1,111 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRequestOptions_GET_WithExtensionsOnly(t *testing.T) {
+	extensions := url.QueryEscape(`{"persistedQuery":{"version":1,"sha256Hash":"abc"}}`)
+	expected := &handler.RequestOptions{
+		Variables: make(map[string]interface{}),
+		Extensions: map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    float64(1),
+				"sha256Hash": "abc",
+			},
+		},
+	}
+
+	req, _ := newCtx("GET", fmt.Sprintf("/graphql?extensions=%s", extensions), nil)
+	result := handler.NewRequestOptions(req)
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result))
+	}
+}
+
+func TestHandler_PersistedQuery_Handshake(t *testing.T) {
+	query := "{ hero { name } }"
+	extensions := fmt.Sprintf(`{"persistedQuery":{"version":1,"sha256Hash":"%s"}}`, sha256Hex(query))
+	hashOnlyURL := fmt.Sprintf("/graphql?extensions=%s", url.QueryEscape(extensions))
+
+	h := handler.New(&handler.Config{
+		Schema: &testutil.StarWarsSchema,
+	})
+
+	// the hash is unknown at first
+	result := executeTest(t, h, newHTTPCtx("GET", hashOnlyURL, nil))
+	if len(result.Errors) != 1 || result.Errors[0].Message != "PersistedQueryNotFound" {
+		t.Fatalf("expected PersistedQueryNotFound, got %v", result.Errors)
+	}
+	if code := result.Errors[0].Extensions["code"]; code != "PERSISTED_QUERY_NOT_FOUND" {
+		t.Fatalf("wrong error code, got %v", code)
+	}
+
+	// the client then sends both the hash and the query
+	body := fmt.Sprintf(`{"query": %q, "extensions": %s}`, query, extensions)
+	httpCtx := newHTTPCtx("POST", "/graphql", []byte(body))
+	httpCtx.Request.Header.SetContentType("application/json")
+	result = executeTest(t, h, httpCtx)
+	if result.HasErrors() {
+		t.Fatalf("unexpected errors %v", result.Errors)
+	}
+
+	// from now on the hash alone is enough
+	result = executeTest(t, h, newHTTPCtx("GET", hashOnlyURL, nil))
+	expected := map[string]interface{}{"hero": map[string]interface{}{"name": "R2-D2"}}
+	if result.HasErrors() || !reflect.DeepEqual(result.Data, expected) {
+		t.Fatalf("wrong result, graphql result diff: %v", testutil.Diff(expected, result.Data))
+	}
+}
+
+func TestHandler_PersistedQuery_HashMismatch(t *testing.T) {
+	extensions := fmt.Sprintf(`{"persistedQuery":{"version":1,"sha256Hash":"%s"}}`, sha256Hex("{ other }"))
+	body := fmt.Sprintf(`{"query": "{ hero { name } }", "extensions": %s}`, extensions)
+	httpCtx := newHTTPCtx("POST", "/graphql", []byte(body))
+	httpCtx.Request.Header.SetContentType("application/json")
+
+	store := handler.NewLRUPersistedQueryStore(10)
+	h := handler.New(&handler.Config{
+		Schema:              &testutil.StarWarsSchema,
+		PersistedQueryStore: store,
+	})
+	result := executeTest(t, h, httpCtx)
+	if len(result.Errors) != 1 || result.Errors[0].Message != "provided sha does not match query" {
+		t.Fatalf("expected a hash mismatch error, got %v", result.Errors)
+	}
+	if _, ok := store.Get(context.Background(), sha256Hex("{ other }")); ok {
+		t.Fatalf("expected the mismatching query not to be stored")
+	}
+}
+
+func TestLRUPersistedQueryStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	store := handler.NewLRUPersistedQueryStore(2)
+	store.Put(ctx, "a", "{ a }")
+	store.Put(ctx, "b", "{ b }")
+	store.Get(ctx, "a")
+	store.Put(ctx, "c", "{ c }")
+
+	if _, ok := store.Get(ctx, "b"); ok {
+		t.Fatalf("expected the least recently used entry to be evicted")
+	}
+	for _, hash := range []string{"a", "c"} {
+		if _, ok := store.Get(ctx, hash); !ok {
+			t.Fatalf("expected %q to be stored", hash)
+		}
+	}
+}
@@ -106,6 +106,26 @@ func TestRequestOptions_POST_BasicQueryString_WithNoBody(t *testing.T) {
 	}
 }
 
+func TestRequestOptions_POST_ContentTypeApplicationJSON_WithURLParameters(t *testing.T) {
+	body := `
+	{
+		"query": "query RebelsShipsQuery { rebels { name } }"
+	}`
+	expected := &handler.RequestOptions{
+		Query: "query RebelsShipsQuery { rebels { name } }",
+	}
+
+	for _, queryString := range []string{"id=tenant1", "documentId=tenant1", `extensions={"tenant":1}`} {
+		req, _ := newCtx("POST", "/graphql?"+queryString, bytes.NewBufferString(body))
+		req.Request.Header.SetContentType("application/json")
+		result := handler.NewRequestOptions(req)
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("wrong result for %s, graphql result diff: %v", queryString, testutil.Diff(expected, result))
+		}
+	}
+}
+
 func TestRequestOptions_POST_ContentTypeApplicationGraphQL(t *testing.T) {
 	body := []byte(`query RebelsShipsQuery { rebels { name } }`)
 	expected := &handler.RequestOptions{
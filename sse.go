@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"time"
+)
+
+// ContentTypeEventStream is the media type of Server-Sent Events responses.
+const ContentTypeEventStream = "text/event-stream"
+
+// DefaultSSEHeartbeatInterval is how often an idle event stream is sent a
+// heartbeat comment when Config.SSEHeartbeatInterval is not set.
+const DefaultSSEHeartbeatInterval = 12 * time.Second
+
+// graphql-sse event types
+const (
+	sseNext     = "next"
+	sseComplete = "complete"
+)
+
+// acceptsEventStream reports whether the Accept header of the request accepts
+// text/event-stream responses.
+func acceptsEventStream(ctxreq *fasthttp.RequestCtx) bool {
+	_, ok := acceptedMediaRange(string(ctxreq.Request.Header.Peek("Accept")), ContentTypeEventStream)
+	return ok
+}
+
+// serveEventStream executes an operation, streaming its results as
+// Server-Sent Events following the distinct connections mode of the
+// graphql-sse protocol: a next event per result, then a complete event.
+// Operations rejected before their execution are answered with a regular
+// JSON response, as are the results of middlewares short-circuiting them.
+func (h *Handler) serveEventStream(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) {
+	var results chan *graphql.Result
+	var cancel context.CancelFunc
+	status := http.StatusOK
+	execute := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result {
+		op, result, rejected := h.prepareOperation(ctx, ctxreq, opts)
+		if result == nil {
+			// EventSource clients can only send GET requests, so subscriptions
+			// are let through along with queries
+			result, rejected = h.checkGETOperation(ctx, ctxreq, op, ast.OperationTypeSubscription)
+		}
+		if result != nil {
+			status = rejected
+			return result
+		}
+
+		// subscriptions last until the client goes away, other operations are
+		// bound to their timeout
+		subscription := op.definition != nil && op.definition.Operation == ast.OperationTypeSubscription
+		var timeout time.Duration
+		if !subscription {
+			timeout = h.operationTimeout(ctxreq, opts)
+		}
+		ctx, cancel = h.operationContext(ctx, ctxreq, timeout)
+		if subscription {
+			results = h.subscribeOperation(ctx, ctxreq, op)
+			return &graphql.Result{}
+		}
+		return h.executeOperation(ctx, ctxreq, op)
+	}
+
+	result := h.runMiddlewares(ctx, ctxreq, opts, execute)
+	if cancel == nil {
+		// the operation was rejected, or a middleware answered it
+		h.writeJSON(ctxreq, h.runResultHook(ctx, ctxreq, opts, result), status)
+		return
+	}
+	if results == nil {
+		results = make(chan *graphql.Result, 1)
+		results <- result
+		close(results)
+	}
+
+	ctxreq.Response.SetStatusCode(http.StatusOK)
+	ctxreq.Response.Header.SetContentType(ContentTypeEventStream + "; charset=utf-8")
+	ctxreq.Response.Header.Set("Cache-Control", "no-cache")
+	ctxreq.Response.Header.Set("X-Accel-Buffering", "no")
+	ctxreq.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		var heartbeat <-chan time.Time
+		if h.sseHeartbeatInterval > 0 {
+			ticker := time.NewTicker(h.sseHeartbeatInterval)
+			defer ticker.Stop()
+			heartbeat = ticker.C
+		}
+
+		// the client went away once a write fails; the context is cancelled
+		// and the channel drained so the executor can return. A timed out
+		// operation still delivers its TIMEOUT error.
+		var gone bool
+		for {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					if !gone {
+						writeEvent(w, sseComplete, nil)
+					}
+					return
+				}
+				if !gone && writeEvent(w, sseNext, result) != nil {
+					gone = true
+					cancel()
+				}
+			case <-heartbeat:
+				if !gone && writeHeartbeat(w) != nil {
+					gone = true
+					cancel()
+				}
+			}
+		}
+	})
+}
+
+// writeEvent writes and flushes a Server-Sent Event carrying v as JSON data.
+func writeEvent(w *bufio.Writer, event string, v interface{}) error {
+	w.WriteString("event: " + event + "\n")
+	w.WriteString("data:")
+	if v != nil {
+		buff, _ := json.Marshal(v)
+		w.WriteString(" ")
+		w.Write(buff)
+	}
+	w.WriteString("\n\n")
+	return w.Flush()
+}
+
+// writeHeartbeat writes and flushes a comment keeping the connection alive.
+func writeHeartbeat(w *bufio.Writer) error {
+	w.WriteString(":\n\n")
+	return w.Flush()
+}
@@ -0,0 +1,148 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveEventStreamTest serves h on an in-memory listener and sends it a GET
+// request accepting Server-Sent Events.
+func serveEventStreamTest(t *testing.T, h *handler.Handler, url string) *http.Response {
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: h.ServeHTTP}
+	go server.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) { return ln.Dial() },
+	}}
+	req, _ := http.NewRequest("GET", "http://localhost"+url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readEvents reads the events of a stream, skipping heartbeat comments.
+func readEvents(t *testing.T, resp *http.Response) []string {
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event != "" {
+				events = append(events, event)
+			}
+			event = ""
+		case strings.HasPrefix(line, ":"):
+		default:
+			if event != "" {
+				event += "\n"
+			}
+			event += line
+		}
+	}
+	return events
+}
+
+func TestEventStream_Subscription(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	resp := serveEventStreamTest(t, h, "/graphql?query=subscription{countdown(from:2)}")
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Fatalf("unexpected content type, got %q", contentType)
+	}
+
+	expected := []string{
+		"event: next\ndata: {\"data\":{\"countdown\":2}}",
+		"event: next\ndata: {\"data\":{\"countdown\":1}}",
+		"event: complete\ndata:",
+	}
+	if events := readEvents(t, resp); strings.Join(events, "|") != strings.Join(expected, "|") {
+		t.Fatalf("wrong events, expected %q, got %q", expected, events)
+	}
+}
+
+func TestEventStream_Query(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	resp := serveEventStreamTest(t, h, "/graphql?query={__typename}")
+
+	expected := []string{
+		"event: next\ndata: {\"data\":{\"__typename\":\"Query\"}}",
+		"event: complete\ndata:",
+	}
+	if events := readEvents(t, resp); strings.Join(events, "|") != strings.Join(expected, "|") {
+		t.Fatalf("wrong events, expected %q, got %q", expected, events)
+	}
+}
+
+func TestEventStream_Rejected(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema, GraphQLOverHTTP: true})
+	resp := serveEventStreamTest(t, h, "/graphql?query=subscription{unknown}")
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Fatalf("unexpected content type, got %q", contentType)
+	}
+}
+
+func TestEventStream_Heartbeat(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: graphql.Fields{"ok": &graphql.Field{Type: graphql.Boolean}},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"never": &graphql.Field{
+					Type: graphql.Boolean,
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						c := make(chan interface{})
+						go func() {
+							<-p.Context.Done()
+							close(c)
+						}()
+						return c, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handler.New(&handler.Config{
+		Schema:               &schema,
+		SSEHeartbeatInterval: 10 * time.Millisecond,
+	})
+	resp := serveEventStreamTest(t, h, "/graphql?query=subscription{never}")
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != ":\n" {
+		t.Fatalf("expected a heartbeat comment, got %q (%v)", line, err)
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"strconv"
+	"strings"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer of the handler.
+const instrumentationName = "github.com/nidrahou/graphql-fasthttp-handler"
+
+// Names of the OpenTelemetry spans started by the handler.
+const (
+	SpanRequest  = "graphql.request"
+	SpanParse    = "graphql.parse"
+	SpanValidate = "graphql.validate"
+	SpanExecute  = "graphql.execute"
+	SpanResolve  = "graphql.resolve"
+
+	// SpanOperation is the span of each operation of a batch, which share
+	// the span of their request.
+	SpanOperation = "graphql.operation"
+)
+
+// noopSpan is returned when OpenTelemetry is disabled.
+var noopSpan = oteltrace.SpanFromContext(context.Background())
+
+// headerCarrier adapts the headers of a fasthttp request to a
+// propagation.TextMapCarrier.
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	c.header.Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	var keys []string
+	c.header.VisitAll(func(key, value []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// startSpan starts a span when a TracerProvider is configured.
+func (h *Handler) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, oteltrace.Span) {
+	if h.tracer == nil {
+		return ctx, noopSpan
+	}
+	return h.tracer.Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// startRequestSpan starts the span of a request, as a child of the span
+// context propagated in its headers.
+func (h *Handler) startRequestSpan(ctx context.Context, ctxreq *fasthttp.RequestCtx) (context.Context, oteltrace.Span) {
+	if h.tracer == nil {
+		return ctx, noopSpan
+	}
+
+	ctx = h.propagator.Extract(ctx, headerCarrier{&ctxreq.Request.Header})
+	return h.tracer.Start(ctx, SpanRequest,
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(
+			attribute.String("http.method", string(ctxreq.Method())),
+			attribute.String("http.target", string(ctxreq.RequestURI())),
+		),
+	)
+}
+
+// endRequestSpan ends the span of a request once it is answered.
+func endRequestSpan(span oteltrace.Span, ctxreq *fasthttp.RequestCtx) {
+	status := ctxreq.Response.StatusCode()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= fasthttp.StatusInternalServerError {
+		span.SetStatus(codes.Error, fasthttp.StatusMessage(status))
+	}
+	span.End()
+}
+
+// endSpan ends a span, marking it as failed when errs is not empty.
+func endSpan(span oteltrace.Span, errs []gqlerrors.FormattedError) {
+	if len(errs) > 0 {
+		span.SetStatus(codes.Error, errs[0].Message)
+	}
+	span.End()
+}
+
+// setOperationAttributes describes the operation in the span of ctx.
+func setOperationAttributes(ctx context.Context, opts *RequestOptions, definition *ast.OperationDefinition) {
+	span := oteltrace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	span.SetAttributes(attribute.String("graphql.document.hash", documentHash(opts.Query)))
+	if definition == nil {
+		return
+	}
+	span.SetAttributes(attribute.String("graphql.operation.type", definition.Operation))
+	if definition.Name != nil {
+		span.SetAttributes(attribute.String("graphql.operation.name", definition.Name.Value))
+	}
+}
+
+// resolverSpanExtension is the graphql-go extension starting a span for each
+// resolved field.
+type resolverSpanExtension struct {
+	tracer oteltrace.Tracer
+}
+
+var _ graphql.Extension = resolverSpanExtension{}
+
+func (resolverSpanExtension) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return ctx
+}
+
+func (resolverSpanExtension) Name() string {
+	return "opentelemetry"
+}
+
+func (resolverSpanExtension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(err error) {}
+}
+
+func (resolverSpanExtension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func(errs []gqlerrors.FormattedError) {}
+}
+
+func (resolverSpanExtension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(result *graphql.Result) {}
+}
+
+// ResolveFieldDidStart starts the span of a field. The context of the
+// resolvers can't be replaced, so the spans of every field are children of
+// the execution span.
+func (e resolverSpanExtension) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	_, span := e.tracer.Start(ctx, SpanResolve, oteltrace.WithAttributes(
+		attribute.String("graphql.field.name", info.FieldName),
+		attribute.String("graphql.field.path", fieldPath(info.Path)),
+		attribute.String("graphql.field.type", info.ReturnType.String()),
+		attribute.String("graphql.parent.type", info.ParentType.Name()),
+	))
+	return ctx, func(v interface{}, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (resolverSpanExtension) HasResult() bool {
+	return false
+}
+
+func (resolverSpanExtension) GetResult(ctx context.Context) interface{} {
+	return nil
+}
+
+// fieldPath formats the path of a field, e.g. hero.friends.0.name.
+func fieldPath(path *graphql.ResponsePath) string {
+	if path == nil {
+		return ""
+	}
+
+	segments := path.AsArray()
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		switch segment := segment.(type) {
+		case string:
+			parts[i] = segment
+		case int:
+			parts[i] = strconv.Itoa(segment)
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func newTelemetryHandler(config *handler.Config) (*handler.Handler, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	config.Schema = &testutil.StarWarsSchema
+	config.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return handler.New(config), exporter
+}
+
+// spansByName indexes the exported spans by name, keeping the last one.
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func spanAttribute(span tracetest.SpanStub, key string) attribute.Value {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHandler_TracerProvider(t *testing.T) {
+	h, exporter := newTelemetryHandler(&handler.Config{})
+
+	ctx := newHTTPCtx("GET", "/graphql?query=query+HeroName{hero{name}}", nil)
+	ctx.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	executeTest(t, h, ctx)
+
+	spans := spansByName(exporter)
+	request, ok := spans[handler.SpanRequest]
+	if !ok {
+		t.Fatalf("expected a request span, got %v", spans)
+	}
+	if traceID := request.SpanContext.TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("wrong trace id, expected the propagated one, got %v", traceID)
+	}
+	if parent := request.Parent.SpanID().String(); parent != "00f067aa0ba902b7" {
+		t.Fatalf("wrong parent span, expected the propagated one, got %v", parent)
+	}
+
+	expected := map[string]string{
+		"graphql.operation.name": "HeroName",
+		"graphql.operation.type": "query",
+	}
+	for key, value := range expected {
+		if actual := spanAttribute(request, key).AsString(); actual != value {
+			t.Fatalf("wrong %s attribute, expected %q, got %q", key, value, actual)
+		}
+	}
+
+	if hash := spanAttribute(request, "graphql.document.hash").AsString(); len(hash) != 64 {
+		t.Fatalf("expected a SHA-256 document hash, got %q", hash)
+	}
+
+	for _, name := range []string{handler.SpanParse, handler.SpanValidate, handler.SpanExecute} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("expected a %s span, got %v", name, spans)
+		}
+		if span.Parent.SpanID() != request.SpanContext.SpanID() {
+			t.Fatalf("expected %s to be a child of the request span", name)
+		}
+	}
+	if _, ok := spans[handler.SpanResolve]; ok {
+		t.Fatal("expected no resolver spans unless enabled")
+	}
+}
+
+func TestHandler_ResolverSpans(t *testing.T) {
+	h, exporter := newTelemetryHandler(&handler.Config{ResolverSpans: true})
+
+	executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{friends{name}}}", nil))
+
+	execute := spansByName(exporter)[handler.SpanExecute]
+	paths := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		if span.Name != handler.SpanResolve {
+			continue
+		}
+		if span.Parent.SpanID() != execute.SpanContext.SpanID() {
+			t.Fatalf("expected resolver spans to be children of the execute span")
+		}
+		paths[spanAttribute(span, "graphql.field.path").AsString()] = true
+	}
+	for _, path := range []string{"hero", "hero.friends", "hero.friends.0.name"} {
+		if !paths[path] {
+			t.Fatalf("expected a resolver span for %s, got %v", path, paths)
+		}
+	}
+}
+
+func TestHandler_TracerProviderBatch(t *testing.T) {
+	h, exporter := newTelemetryHandler(&handler.Config{})
+
+	body, _ := json.Marshal([]map[string]string{
+		{"query": "query First{hero{name}}"},
+		{"query": "query Second{hero{id}}"},
+	})
+	ctx := newHTTPCtx("POST", "/graphql", body)
+	ctx.Request.Header.SetContentType("application/json")
+	h.ServeHTTP(ctx)
+
+	names := map[string]bool{}
+	for _, span := range exporter.GetSpans() {
+		if span.Name == handler.SpanOperation {
+			names[spanAttribute(span, "graphql.operation.name").AsString()] = true
+		}
+	}
+	if !names["First"] || !names["Second"] {
+		t.Fatalf("expected an operation span per batched operation, got %v", names)
+	}
+}
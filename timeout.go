@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeoutStatus is the status code of the responses to operations
+// exceeding their timeout when Config.TimeoutStatus is not set.
+const DefaultTimeoutStatus = http.StatusGatewayTimeout
+
+// TimeoutFn returns the timeout of an operation, overriding Config.Timeout.
+// Zero disables the timeout of the operation.
+type TimeoutFn func(ctxreq *fasthttp.RequestCtx, opts *RequestOptions) time.Duration
+
+// operationTimeout returns the timeout of the operation described by opts.
+func (h *Handler) operationTimeout(ctxreq *fasthttp.RequestCtx, opts *RequestOptions) time.Duration {
+	if h.timeoutFn != nil {
+		return h.timeoutFn(ctxreq, opts)
+	}
+	return h.timeout
+}
+
+// newTimeoutResult returns the result of an operation that exceeded its
+// timeout.
+func newTimeoutResult() *graphql.Result {
+	return newErrorResult("Operation timed out", CodeTimeout)
+}
+
+// operationContext derives the context of an operation from ctx, bound to
+// timeout when it is positive and cancelled when the server shuts down. The
+// returned cancel function must be called once the operation is done.
+func (h *Handler) operationContext(ctx context.Context, ctxreq *fasthttp.RequestCtx, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	if done := serverDone(ctxreq); done != nil {
+		cancel = h.shutdownWatcher(done).register(cancel)
+	}
+	return ctx, cancel
+}
+
+// serverDone returns the channel closed when the server serving the request
+// shuts down, or nil when the request is not served by a fasthttp.Server.
+func serverDone(ctxreq *fasthttp.RequestCtx) <-chan struct{} {
+	// RequestCtx.Done is only usable on requests initialised with a
+	// connection, which the zero RequestCtx has not
+	if ctxreq.Conn() == nil {
+		return nil
+	}
+	return ctxreq.Done()
+}
+
+// shutdownWatcher cancels the operations of the requests of a server once it
+// shuts down, with a single goroutine per server.
+type shutdownWatcher struct {
+	mu       sync.Mutex
+	shutdown bool
+	nextID   uint64
+	cancels  map[uint64]context.CancelFunc
+}
+
+// shutdownWatcher returns the watcher of the server whose shutdown closes
+// done, starting it on first use.
+func (h *Handler) shutdownWatcher(done <-chan struct{}) *shutdownWatcher {
+	if w, ok := h.shutdownWatchers.Load(done); ok {
+		return w.(*shutdownWatcher)
+	}
+
+	w, loaded := h.shutdownWatchers.LoadOrStore(done, &shutdownWatcher{cancels: map[uint64]context.CancelFunc{}})
+	if !loaded {
+		go func() {
+			<-done
+			w.(*shutdownWatcher).cancelAll()
+			h.shutdownWatchers.Delete(done)
+		}()
+	}
+	return w.(*shutdownWatcher)
+}
+
+// register calls cancel once the server shuts down. It returns the function
+// cancelling the operation and unregistering it, which must be called once
+// the operation is done.
+func (w *shutdownWatcher) register(cancel context.CancelFunc) context.CancelFunc {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.shutdown {
+		cancel()
+		return cancel
+	}
+
+	id := w.nextID
+	w.nextID++
+	w.cancels[id] = cancel
+	return func() {
+		w.mu.Lock()
+		delete(w.cancels, id)
+		w.mu.Unlock()
+		cancel()
+	}
+}
+
+func (w *shutdownWatcher) cancelAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.shutdown = true
+	for id, cancel := range w.cancels {
+		cancel()
+		delete(w.cancels, id)
+	}
+}
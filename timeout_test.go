@@ -0,0 +1,167 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSlowSchema returns a schema whose slow field waits for its context to be
+// done, reporting the context error on cancelled.
+func newSlowSchema(t *testing.T, cancelled chan<- error) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"slow": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						select {
+						case <-p.Context.Done():
+							cancelled <- p.Context.Err()
+							return nil, p.Context.Err()
+						case <-time.After(5 * time.Second):
+							return "done", nil
+						}
+					},
+				},
+				"fast": &graphql.Field{Type: graphql.String},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestHandler_Timeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	schema := newSlowSchema(t, cancelled)
+	cases := map[string]struct {
+		config         handler.Config
+		expectedStatus int
+	}{
+		"Timeout": {
+			config:         handler.Config{Schema: &schema, Timeout: 10 * time.Millisecond},
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		"TimeoutFn and TimeoutStatus": {
+			config: handler.Config{
+				Schema:  &schema,
+				Timeout: time.Hour,
+				TimeoutFn: func(ctxreq *fasthttp.RequestCtx, opts *handler.RequestOptions) time.Duration {
+					return 10 * time.Millisecond
+				},
+				TimeoutStatus: http.StatusServiceUnavailable,
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for name, tc := range cases {
+		h := handler.New(&tc.config)
+		ctx := newHTTPCtx("GET", "/graphql?query={slow}", nil)
+		result := executeTest(t, h, ctx)
+
+		if ctx.Response.StatusCode() != tc.expectedStatus {
+			t.Fatalf("%s: unexpected status code, got %d", name, ctx.Response.StatusCode())
+		}
+		if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != "TIMEOUT" {
+			t.Fatalf("%s: expected a TIMEOUT error, got %v", name, result.Errors)
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: the resolver context was not cancelled", name)
+		}
+	}
+
+	h := handler.New(&handler.Config{Schema: &schema, Timeout: time.Second})
+	ctx := newHTTPCtx("GET", "/graphql?query={fast}", nil)
+	executeTest(t, h, ctx)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("unexpected status code, got %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestHandler_Shutdown(t *testing.T) {
+	cancelled := make(chan error, 1)
+	schema := newSlowSchema(t, cancelled)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: h.ServeHTTP}
+	go server.Serve(ln)
+
+	go func() {
+		conn, err := ln.Dial()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /graphql?query={slow} HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		conn.Read(make([]byte, 1024))
+	}()
+
+	// let the request reach the resolver before shutting down
+	time.Sleep(50 * time.Millisecond)
+	go server.Shutdown()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the resolver context was not cancelled on shutdown")
+	}
+}
+
+func TestEventStream_Timeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	schema := newSlowSchema(t, cancelled)
+	h := handler.New(&handler.Config{Schema: &schema, Timeout: 10 * time.Millisecond})
+	resp := serveEventStreamTest(t, h, "/graphql?query={slow}")
+
+	events := readEvents(t, resp)
+	if len(events) != 2 || !strings.Contains(events[0], `"code":"TIMEOUT"`) || events[1] != "event: complete\ndata:" {
+		t.Fatalf("expected a TIMEOUT error then complete, got %q", events)
+	}
+}
+
+func TestWebSocket_Timeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	schema := newSlowSchema(t, cancelled)
+	h := handler.New(&handler.Config{Schema: &schema, Timeout: 10 * time.Millisecond})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	if msg := readWebSocketMessage(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{
+		"query": "{ slow }",
+	}})
+	msg := readWebSocketMessage(t, conn)
+	payload, _ := json.Marshal(msg.Payload)
+	if msg.ID != "1" || msg.Type != "next" || !strings.Contains(string(payload), `"code":"TIMEOUT"`) {
+		t.Fatalf("expected a TIMEOUT error, got %v", msg)
+	}
+	if msg := readWebSocketMessage(t, conn); msg.ID != "1" || msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+
+	select {
+	case err := <-cancelled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected the resolver context to exceed its deadline, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the resolver context was not cancelled")
+	}
+}
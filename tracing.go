@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"sync"
+	"time"
+)
+
+// apolloTracingVersion is the version of the Apollo tracing format.
+const apolloTracingVersion = 1
+
+// trace records the timings of an operation in the Apollo tracing format.
+type trace struct {
+	startTime  time.Time
+	parsing    tracingPhase
+	validation tracingPhase
+
+	mu        sync.Mutex
+	resolvers []tracingResolver
+}
+
+// tracingPhase is the timing of a phase of an operation, in nanoseconds
+// relative to the start of the operation.
+type tracingPhase struct {
+	StartOffset int64 `json:"startOffset"`
+	Duration    int64 `json:"duration"`
+}
+
+// tracingResolver is the timing of the resolver of a field.
+type tracingResolver struct {
+	Path        []interface{} `json:"path"`
+	ParentType  string        `json:"parentType"`
+	FieldName   string        `json:"fieldName"`
+	ReturnType  string        `json:"returnType"`
+	StartOffset int64         `json:"startOffset"`
+	Duration    int64         `json:"duration"`
+}
+
+// tracingExecution holds the resolver timings of an operation.
+type tracingExecution struct {
+	Resolvers []tracingResolver `json:"resolvers"`
+}
+
+// tracingResult is the tracing extension of a result.
+type tracingResult struct {
+	Version    int              `json:"version"`
+	StartTime  string           `json:"startTime"`
+	EndTime    string           `json:"endTime"`
+	Duration   int64            `json:"duration"`
+	Parsing    tracingPhase     `json:"parsing"`
+	Validation tracingPhase     `json:"validation"`
+	Execution  tracingExecution `json:"execution"`
+}
+
+func newTrace() *trace {
+	return &trace{startTime: time.Now()}
+}
+
+// phase returns the timing of a phase that started at start and ends now.
+func (t *trace) phase(start time.Time) tracingPhase {
+	return tracingPhase{
+		StartOffset: start.Sub(t.startTime).Nanoseconds(),
+		Duration:    time.Since(start).Nanoseconds(),
+	}
+}
+
+// traceKey is the context key of the trace of an operation.
+type traceKey struct{}
+
+func withTrace(ctx context.Context, t *trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+func traceFromContext(ctx context.Context) *trace {
+	t, _ := ctx.Value(traceKey{}).(*trace)
+	return t
+}
+
+// tracingExtension is the graphql-go extension recording the resolver timings
+// of operations into their trace and adding it to their results.
+type tracingExtension struct{}
+
+var _ graphql.Extension = tracingExtension{}
+
+func (tracingExtension) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return ctx
+}
+
+func (tracingExtension) Name() string {
+	return "tracing"
+}
+
+func (tracingExtension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(err error) {}
+}
+
+func (tracingExtension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func(errs []gqlerrors.FormattedError) {}
+}
+
+// ExecutionDidStart starts a trace for the executions that did not go through
+// the handler pipeline, such as the events of subscriptions.
+func (tracingExtension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	if traceFromContext(ctx) == nil {
+		ctx = withTrace(ctx, newTrace())
+	}
+	return ctx, func(result *graphql.Result) {}
+}
+
+func (tracingExtension) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	t := traceFromContext(ctx)
+	if t == nil {
+		return ctx, func(v interface{}, err error) {}
+	}
+
+	start := time.Now()
+	return ctx, func(v interface{}, err error) {
+		resolver := tracingResolver{
+			ParentType:  info.ParentType.Name(),
+			FieldName:   info.FieldName,
+			ReturnType:  info.ReturnType.String(),
+			StartOffset: start.Sub(t.startTime).Nanoseconds(),
+			Duration:    time.Since(start).Nanoseconds(),
+		}
+		if info.Path != nil {
+			resolver.Path = info.Path.AsArray()
+		}
+
+		t.mu.Lock()
+		t.resolvers = append(t.resolvers, resolver)
+		t.mu.Unlock()
+	}
+}
+
+func (tracingExtension) HasResult() bool {
+	return true
+}
+
+func (tracingExtension) GetResult(ctx context.Context) interface{} {
+	t := traceFromContext(ctx)
+	if t == nil {
+		return nil
+	}
+
+	endTime := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &tracingResult{
+		Version:    apolloTracingVersion,
+		StartTime:  t.startTime.UTC().Format(time.RFC3339Nano),
+		EndTime:    endTime.UTC().Format(time.RFC3339Nano),
+		Duration:   endTime.Sub(t.startTime).Nanoseconds(),
+		Parsing:    t.parsing,
+		Validation: t.validation,
+		Execution: tracingExecution{
+			Resolvers: append([]tracingResolver{}, t.resolvers...),
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package handler_test
+
+import (
+	"github.com/graphql-go/graphql/testutil"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandler_Tracing(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema:  &testutil.StarWarsSchema,
+		Tracing: true,
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name friends{name}}}", nil))
+	if len(result.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+
+	tracing, ok := result.Extensions["tracing"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a tracing extension, got %v", result.Extensions)
+	}
+	if version := tracing["version"]; version != float64(1) {
+		t.Fatalf("wrong version, expected 1, got %v", version)
+	}
+	for _, key := range []string{"startTime", "endTime"} {
+		value, _ := tracing[key].(string)
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			t.Fatalf("wrong %s %q: %v", key, value, err)
+		}
+	}
+	if duration, _ := tracing["duration"].(float64); duration <= 0 {
+		t.Fatalf("expected a positive duration, got %v", tracing["duration"])
+	}
+	for _, phase := range []string{"parsing", "validation"} {
+		if _, ok := tracing[phase].(map[string]interface{})["duration"]; !ok {
+			t.Fatalf("expected the %s phase, got %v", phase, tracing[phase])
+		}
+	}
+
+	resolvers := tracing["execution"].(map[string]interface{})["resolvers"].([]interface{})
+	paths := map[string]map[string]interface{}{}
+	for _, resolver := range resolvers {
+		resolver := resolver.(map[string]interface{})
+		key := ""
+		for _, segment := range resolver["path"].([]interface{}) {
+			key += "/" + toString(segment)
+		}
+		paths[key] = resolver
+	}
+
+	hero, ok := paths["/hero"]
+	if !ok {
+		t.Fatalf("expected the hero resolver, got %v", resolvers)
+	}
+	if hero["parentType"] != "Query" || hero["fieldName"] != "hero" || hero["returnType"] != "Character" {
+		t.Fatalf("wrong hero resolver: %v", hero)
+	}
+	if _, ok := paths["/hero/friends/0/name"]; !ok {
+		t.Fatalf("expected the resolvers of list items, got %v", resolvers)
+	}
+}
+
+func TestHandler_TracingCachedDocument(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema:  &testutil.StarWarsSchema,
+		Tracing: true,
+	})
+
+	for i, expectsPhases := range []bool{true, false} {
+		result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name}}", nil))
+		tracing := result.Extensions["tracing"].(map[string]interface{})
+		for _, phase := range []string{"parsing", "validation"} {
+			duration, _ := tracing[phase].(map[string]interface{})["duration"].(float64)
+			if hasPhase := duration > 0; hasPhase != expectsPhases {
+				t.Fatalf("wrong %s phase of request %d, expected a duration: %v, got %v", phase, i, expectsPhases, tracing[phase])
+			}
+		}
+	}
+}
+
+func TestHandler_TracingDisabled(t *testing.T) {
+	h := handler.New(&handler.Config{
+		Schema: &testutil.StarWarsSchema,
+	})
+
+	result := executeTest(t, h, newHTTPCtx("GET", "/graphql?query={hero{name}}", nil))
+	if _, ok := result.Extensions["tracing"]; ok {
+		t.Fatalf("expected no tracing extension, got %v", result.Extensions)
+	}
+}
+
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.Itoa(int(value))
+	}
+	return ""
+}
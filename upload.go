@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"mime/multipart"
+	"strconv"
+	"strings"
+)
+
+// ContentTypeMultipartFormData is the media type of requests following the
+// GraphQL multipart request specification.
+const ContentTypeMultipartFormData = "multipart/form-data"
+
+// UploadedFile is a file sent along with an operation following the GraphQL
+// multipart request specification. Variables of type Upload are set to an
+// *UploadedFile.
+type UploadedFile struct {
+	Filename    string
+	ContentType string
+	Size        int64
+
+	header *multipart.FileHeader
+}
+
+// Open opens the content of the file. The file is only available while the
+// request is being handled.
+func (f *UploadedFile) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+// Upload is the scalar type of the files sent with the GraphQL multipart
+// request specification. It can only be used as the type of a variable.
+var Upload = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Upload",
+	Description: "The `Upload` scalar type represents a file sent with the GraphQL multipart request specification.",
+	Serialize: func(value interface{}) interface{} {
+		if file, ok := value.(*UploadedFile); ok {
+			return file.Filename
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if file, ok := value.(*UploadedFile); ok {
+			return file
+		}
+		return nil
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+// isMultipartRequest reports whether the request is a multipart POST request.
+func isMultipartRequest(ctx *fasthttp.RequestCtx) bool {
+	contentType := strings.Split(string(ctx.Request.Header.ContentType()), ";")[0]
+	return ctx.Request.Header.IsPost() && strings.TrimSpace(contentType) == ContentTypeMultipartFormData
+}
+
+// parseMultipartRequest parses a request following the GraphQL multipart
+// request specification: the operations field holds an operation or a batch
+// of operations, and the map field maps each file field to the paths of the
+// variables it is set to. It reports whether the operations are a batch.
+func parseMultipartRequest(ctx *fasthttp.RequestCtx) ([]*RequestOptions, bool, error) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return nil, false, fmt.Errorf("malformed multipart request: %v", err)
+	}
+
+	operations := form.Value["operations"]
+	if len(operations) == 0 {
+		return nil, false, fmt.Errorf("missing operations field")
+	}
+
+	body := strings.TrimSpace(operations[0])
+	batch := strings.HasPrefix(body, "[")
+
+	var list []*RequestOptions
+	if batch {
+		var rawOperations []json.RawMessage
+		if err := json.Unmarshal([]byte(body), &rawOperations); err != nil {
+			return nil, batch, fmt.Errorf("malformed operations field: %v", err)
+		}
+		for _, operation := range rawOperations {
+			opts, err := newRequestOptionsFromJSON(operation)
+			if err != nil {
+				return nil, batch, err
+			}
+			list = append(list, opts)
+		}
+	} else {
+		opts, err := newRequestOptionsFromJSON([]byte(body))
+		if err != nil {
+			return nil, batch, err
+		}
+		list = append(list, opts)
+	}
+
+	var fileMap map[string][]string
+	if value := form.Value["map"]; len(value) > 0 {
+		if err := json.Unmarshal([]byte(value[0]), &fileMap); err != nil {
+			return nil, batch, fmt.Errorf("map is invalid JSON: %v", err)
+		}
+	}
+
+	for field, paths := range fileMap {
+		headers := form.File[field]
+		if len(headers) == 0 {
+			return nil, batch, fmt.Errorf("file %q is missing", field)
+		}
+		file := &UploadedFile{
+			Filename:    headers[0].Filename,
+			ContentType: headers[0].Header.Get("Content-Type"),
+			Size:        headers[0].Size,
+			header:      headers[0],
+		}
+
+		for _, path := range paths {
+			segments := strings.Split(path, ".")
+			opts := list[0]
+			if batch {
+				i, err := strconv.Atoi(segments[0])
+				if err != nil || i < 0 || i >= len(list) {
+					return nil, batch, fmt.Errorf("invalid map path %q", path)
+				}
+				opts, segments = list[i], segments[1:]
+			}
+			if opts.Variables == nil {
+				// operations may omit their variables or set them to null
+				opts.Variables = map[string]interface{}{}
+			}
+			if len(segments) < 2 || segments[0] != "variables" || !setVariable(opts.Variables, segments[1:], file) {
+				return nil, batch, fmt.Errorf("invalid map path %q", path)
+			}
+		}
+	}
+
+	return list, batch, nil
+}
+
+// setVariable sets the value at the path of segments in variables, walking
+// objects by key and lists by index. It reports whether the path exists.
+func setVariable(variables interface{}, segments []string, value interface{}) bool {
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch container := variables.(type) {
+		case map[string]interface{}:
+			if last {
+				container[segment] = value
+				return true
+			}
+			variables = container[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(container) {
+				return false
+			}
+			if last {
+				container[index] = value
+				return true
+			}
+			variables = container[index]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// checkUploadLimits enforces MaxUploadSize and MaxUploadFiles on multipart
+// requests. It returns a non-nil result when the request is rejected.
+func (h *Handler) checkUploadLimits(ctxreq *fasthttp.RequestCtx) *graphql.Result {
+	if (h.maxUploadSize <= 0 && h.maxUploadFiles <= 0) || !isMultipartRequest(ctxreq) {
+		return nil
+	}
+
+	form, err := ctxreq.MultipartForm()
+	if err != nil {
+		// malformed requests are reported while parsing them
+		return nil
+	}
+
+	files := 0
+	for _, headers := range form.File {
+		for _, header := range headers {
+			files++
+			if h.maxUploadSize > 0 && header.Size > h.maxUploadSize {
+				message := fmt.Sprintf("File %q exceeds the maximum size of %d bytes", header.Filename, h.maxUploadSize)
+				return newErrorResult(message, CodeUploadTooLarge)
+			}
+		}
+	}
+	if h.maxUploadFiles > 0 && files > h.maxUploadFiles {
+		message := fmt.Sprintf("Request holds %d files, which exceeds the maximum of %d", files, h.maxUploadFiles)
+		return newErrorResult(message, CodeTooManyUploads)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package handler_test
+
+import (
+	"bytes"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func newUploadSchema(t *testing.T) graphql.Schema {
+	fileField := &graphql.Field{
+		Type: graphql.String,
+		Args: graphql.FieldConfigArgument{
+			"file": &graphql.ArgumentConfig{Type: handler.Upload},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			file := p.Args["file"].(*handler.UploadedFile)
+			f, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			content, err := ioutil.ReadAll(f)
+			return file.Filename + ": " + string(content), err
+		},
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: graphql.Fields{"ok": &graphql.Field{Type: graphql.Boolean}},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"upload": fileField,
+				"uploadMany": &graphql.Field{
+					Type: graphql.NewList(graphql.String),
+					Args: graphql.FieldConfigArgument{
+						"files": &graphql.ArgumentConfig{Type: graphql.NewList(handler.Upload)},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var names []interface{}
+						for _, file := range p.Args["files"].([]interface{}) {
+							names = append(names, file.(*handler.UploadedFile).Filename)
+						}
+						return names, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// newUploadCtx builds a multipart request with the operations and map fields
+// and a file field per entry of files.
+func newUploadCtx(t *testing.T, operations, fileMap string, files map[string]string) *fasthttp.RequestCtx {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("operations", operations)
+	w.WriteField("map", fileMap)
+	for field, content := range files {
+		part, err := w.CreateFormFile(field, field+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	w.Close()
+
+	ctx := newHTTPCtx("POST", "/graphql", body.Bytes())
+	ctx.Request.Header.SetContentType(w.FormDataContentType())
+	return ctx
+}
+
+func TestHandler_Upload(t *testing.T) {
+	schema := newUploadSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	ctx := newUploadCtx(t,
+		`{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":{"file":null}}`,
+		`{"0":["variables.file"]}`,
+		map[string]string{"0": "hello"},
+	)
+	result := executeTest(t, h, ctx)
+	expected := &graphql.Result{Data: map[string]interface{}{"upload": "0.txt: hello"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, expected %v, got %v", expected, result)
+	}
+}
+
+func TestHandler_Upload_List(t *testing.T) {
+	schema := newUploadSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	ctx := newUploadCtx(t,
+		`{"query":"mutation ($files: [Upload]) { uploadMany(files: $files) }","variables":{"files":[null,null]}}`,
+		`{"a":["variables.files.0"],"b":["variables.files.1"]}`,
+		map[string]string{"a": "first", "b": "second"},
+	)
+	result := executeTest(t, h, ctx)
+	expected := &graphql.Result{Data: map[string]interface{}{"uploadMany": []interface{}{"a.txt", "b.txt"}}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("wrong result, expected %v, got %v", expected, result)
+	}
+}
+
+func TestHandler_Upload_Batch(t *testing.T) {
+	schema := newUploadSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	ctx := newUploadCtx(t,
+		`[{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":{"file":null}},`+
+			`{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":{"file":null}}]`,
+		`{"0":["0.variables.file"],"1":["1.variables.file"]}`,
+		map[string]string{"0": "first", "1": "second"},
+	)
+	h.ServeHTTP(ctx)
+	results := decodeBatchResponse(t, ctx)
+	expected := []*graphql.Result{
+		{Data: map[string]interface{}{"upload": "0.txt: first"}},
+		{Data: map[string]interface{}{"upload": "1.txt: second"}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("wrong results, expected %v, got %v", expected, results)
+	}
+}
+
+func TestHandler_Upload_InvalidMap(t *testing.T) {
+	schema := newUploadSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema, GraphQLOverHTTP: true})
+
+	for name, fileMap := range map[string]string{
+		"missing file":      `{"1":["variables.file"]}`,
+		"invalid path":      `{"0":["variables.missing.file"]}`,
+		"outside variables": `{"0":["query"]}`,
+	} {
+		ctx := newUploadCtx(t,
+			`{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":{"file":null}}`,
+			fileMap,
+			map[string]string{"0": "hello"},
+		)
+		h.ServeHTTP(ctx)
+		if ctx.Response.StatusCode() != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected status code, got %d", name, ctx.Response.StatusCode())
+		}
+	}
+}
+
+func TestHandler_Upload_NoVariables(t *testing.T) {
+	schema := newUploadSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	for name, operation := range map[string]string{
+		"missing variables": `{"query":"mutation ($file: Upload) { upload(file: $file) }"}`,
+		"null variables":    `{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":null}`,
+	} {
+		ctx := newUploadCtx(t, operation, `{"0":["variables.file"]}`, map[string]string{"0": "hello"})
+		result := executeTest(t, h, ctx)
+		expected := &graphql.Result{Data: map[string]interface{}{"upload": "0.txt: hello"}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("%s: wrong result, expected %v, got %v", name, expected, result)
+		}
+
+		ctx = newUploadCtx(t, "["+operation+","+operation+"]",
+			`{"0":["0.variables.file"],"1":["1.variables.file"]}`,
+			map[string]string{"0": "first", "1": "second"},
+		)
+		h.ServeHTTP(ctx)
+		results := decodeBatchResponse(t, ctx)
+		expectedResults := []*graphql.Result{
+			{Data: map[string]interface{}{"upload": "0.txt: first"}},
+			{Data: map[string]interface{}{"upload": "1.txt: second"}},
+		}
+		if !reflect.DeepEqual(results, expectedResults) {
+			t.Fatalf("%s: wrong results, expected %v, got %v", name, expectedResults, results)
+		}
+	}
+}
+
+func TestHandler_Upload_Limits(t *testing.T) {
+	schema := newUploadSchema(t)
+	cases := map[string]struct {
+		config handler.Config
+		files  map[string]string
+		code   string
+	}{
+		"file too large": {
+			config: handler.Config{Schema: &schema, MaxUploadSize: 4},
+			files:  map[string]string{"0": "hello"},
+			code:   "UPLOAD_TOO_LARGE",
+		},
+		"too many files": {
+			config: handler.Config{Schema: &schema, MaxUploadFiles: 1},
+			files:  map[string]string{"0": "a", "1": "b"},
+			code:   "TOO_MANY_UPLOADS",
+		},
+	}
+	for name, tc := range cases {
+		h := handler.New(&tc.config)
+		ctx := newUploadCtx(t,
+			`{"query":"mutation ($file: Upload) { upload(file: $file) }","variables":{"file":null}}`,
+			`{"0":["variables.file"]}`,
+			tc.files,
+		)
+		result := executeTest(t, h, ctx)
+		if ctx.Response.StatusCode() != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: unexpected status code, got %d", name, ctx.Response.StatusCode())
+		}
+		if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != tc.code {
+			t.Fatalf("%s: expected a %s error, got %v", name, tc.code, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fasthttp/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket subprotocols of the supported GraphQL over WebSocket protocols.
+const (
+	// ProtocolGraphQLTransportWS is the subprotocol of the
+	// graphql-transport-ws protocol.
+	ProtocolGraphQLTransportWS = "graphql-transport-ws"
+
+	// ProtocolGraphQLWS is the subprotocol of the legacy
+	// subscriptions-transport-ws protocol.
+	ProtocolGraphQLWS = "graphql-ws"
+)
+
+// webSocketSubprotocols lists the supported subprotocols in order of
+// preference.
+var webSocketSubprotocols = []string{ProtocolGraphQLTransportWS, ProtocolGraphQLWS}
+
+// DefaultMaxWebSocketOperations is the default maximum number of operations
+// running at once on a WebSocket connection.
+const DefaultMaxWebSocketOperations = 100
+
+// DefaultConnectionInitTimeout is how long a WebSocket client has to send its
+// connection_init message when Config.ConnectionInitTimeout is not set.
+const DefaultConnectionInitTimeout = 3 * time.Second
+
+// ConnectionInitFn is called with the payload of the connection_init message
+// of a WebSocket connection, along with the headers of the upgrade request,
+// e.g. to authenticate the client. The returned context is used to execute
+// the operations of the connection; returning an error refuses it.
+type ConnectionInitFn func(ctx context.Context, header *fasthttp.RequestHeader, payload map[string]interface{}) (context.Context, error)
+
+// wsMessage is a message received from a WebSocket client.
+type wsMessage struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// wsOutgoingMessage is a message sent to a WebSocket client.
+type wsOutgoingMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// wsProtocol implements the messages of a GraphQL over WebSocket protocol.
+type wsProtocol interface {
+	// handleMessage handles a message of the client. It reports whether the
+	// connection is still open.
+	handleMessage(c *wsConnection, msg *wsMessage) bool
+
+	// keepAlive returns the message periodically sent to the client.
+	keepAlive() *wsOutgoingMessage
+
+	// next returns the message carrying a result of the operation id.
+	next(id string, result *graphql.Result) *wsOutgoingMessage
+
+	// reject sends the errors of the operation id that was rejected before
+	// its execution.
+	reject(c *wsConnection, id string, result *graphql.Result)
+
+	// complete returns the message telling the client the operation id is
+	// done.
+	complete(id string) *wsOutgoingMessage
+
+	// initTimeout closes the connection of a client that did not initialise
+	// it in time.
+	initTimeout(c *wsConnection)
+}
+
+// wsConnection is a WebSocket connection serving GraphQL operations.
+type wsConnection struct {
+	h        *Handler
+	conn     *websocket.Conn
+	protocol wsProtocol
+
+	// ctxreq holds a copy of the upgrade request, since the original request
+	// can't be used once the connection is hijacked.
+	ctxreq *fasthttp.RequestCtx
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	ctx           context.Context
+	cancel        context.CancelFunc
+	initReceived  bool
+	acknowledged  bool
+	subscriptions map[string]context.CancelFunc
+	done          chan struct{}
+
+	// workers tracks the goroutines writing to the connection, which must
+	// return before the hijacked connection is released.
+	workers sync.WaitGroup
+}
+
+// serveWebSocket upgrades the request to a WebSocket connection serving
+// GraphQL operations with the subprotocol negotiated with the client.
+func (h *Handler) serveWebSocket(ctx context.Context, ctxreq *fasthttp.RequestCtx) {
+	var protocol wsProtocol
+	switch negotiateSubprotocol(ctxreq) {
+	case ProtocolGraphQLTransportWS:
+		protocol = transportWSProtocol{}
+	case ProtocolGraphQLWS:
+		protocol = graphqlWSProtocol{}
+	default:
+		httpError(ctxreq, "Unsupported WebSocket subprotocol", http.StatusBadRequest)
+		return
+	}
+
+	snapshot := &fasthttp.RequestCtx{}
+	ctxreq.Request.CopyTo(&snapshot.Request)
+	ctx = withRequestLock(withRequestCtx(ctx, snapshot))
+	shutdown := serverDone(ctxreq)
+
+	upgrader := websocket.FastHTTPUpgrader{
+		Subprotocols: webSocketSubprotocols,
+		CheckOrigin:  h.webSocketCheckOrigin,
+	}
+	upgrader.Upgrade(ctxreq, func(conn *websocket.Conn) {
+		if h.maxBodyBytes > 0 {
+			// messages are read in full, like request bodies
+			conn.SetReadLimit(int64(h.maxBodyBytes))
+		}
+		c := &wsConnection{
+			h:             h,
+			conn:          conn,
+			protocol:      protocol,
+			ctxreq:        snapshot,
+			ctx:           ctx,
+			subscriptions: map[string]context.CancelFunc{},
+			done:          make(chan struct{}),
+		}
+		c.serve(shutdown)
+	})
+}
+
+// negotiateSubprotocol returns the preferred supported subprotocol the client
+// offers in its Sec-WebSocket-Protocol header.
+func negotiateSubprotocol(ctxreq *fasthttp.RequestCtx) string {
+	offered := map[string]bool{}
+	for _, protocol := range strings.Split(string(ctxreq.Request.Header.Peek("Sec-WebSocket-Protocol")), ",") {
+		offered[strings.TrimSpace(protocol)] = true
+	}
+	for _, protocol := range webSocketSubprotocols {
+		if offered[protocol] {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// serve reads the messages of the client until the connection is closed, or
+// until shutdown is closed.
+func (c *wsConnection) serve(shutdown <-chan struct{}) {
+	defer c.close()
+
+	if shutdown != nil {
+		c.workers.Add(1)
+		go func() {
+			defer c.workers.Done()
+			select {
+			case <-shutdown:
+				c.closeWith(websocket.CloseGoingAway, "Server shutting down")
+			case <-c.done:
+			}
+		}()
+	}
+
+	initTimer := time.AfterFunc(c.h.connectionInitTimeout, func() {
+		if !c.isAcknowledged() {
+			c.protocol.initTimeout(c)
+		}
+	})
+	defer initTimer.Stop()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			msg = wsMessage{}
+		}
+		if !c.protocol.handleMessage(c, &msg) {
+			return
+		}
+	}
+}
+
+// init initialises the connection with the payload of the client, running
+// the ConnectionInitFn. It reports whether the connection was initialised
+// before and the error refusing the connection, if any.
+func (c *wsConnection) init(rawPayload json.RawMessage) (bool, error) {
+	c.mu.Lock()
+	initReceived := c.initReceived
+	c.initReceived = true
+	ctx := c.ctx
+	c.mu.Unlock()
+	if initReceived {
+		return true, nil
+	}
+
+	var payload map[string]interface{}
+	if len(rawPayload) > 0 {
+		json.Unmarshal(rawPayload, &payload)
+	}
+	if c.h.connectionInitFn != nil {
+		var err error
+		ctx, err = c.h.connectionInitFn(ctx, &c.ctxreq.Request.Header, payload)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c.mu.Lock()
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.acknowledged = true
+	c.mu.Unlock()
+	return false, nil
+}
+
+// isAcknowledged reports whether the connection was initialised.
+func (c *wsConnection) isAcknowledged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.acknowledged
+}
+
+// startKeepAlive periodically sends the keep-alive message of the protocol
+// until the connection is closed. It is called once the connection is
+// acknowledged, and does nothing when Config.KeepAliveInterval is not set.
+func (c *wsConnection) startKeepAlive() {
+	if c.h.keepAliveInterval <= 0 {
+		return
+	}
+
+	c.workers.Add(1)
+	go c.keepAlive()
+}
+
+func (c *wsConnection) keepAlive() {
+	defer c.workers.Done()
+
+	ticker := time.NewTicker(c.h.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.send(c.protocol.keepAlive())
+		}
+	}
+}
+
+// start registers the operation id and executes it in the background. It
+// reports false when the id is already in use. Operations exceeding
+// maxWebSocketOperations are rejected.
+func (c *wsConnection) start(id string, opts *RequestOptions) bool {
+	// operations are only started by the reader of the connection, so the
+	// count can't grow before the operation is added
+	if max := c.h.maxWebSocketOperations; max > 0 && c.activeOperations() >= max {
+		start := time.Now()
+		message := fmt.Sprintf("Connection runs more than the maximum of %d operations", max)
+		c.mu.Lock()
+		ctx := c.ctx
+		c.mu.Unlock()
+		result := c.h.formatErrors(ctx, newErrorResult(message, CodeTooManyOperations))
+		c.h.reportRejection(opts, nil, start, result, c.h.requestErrorStatus())
+		c.protocol.reject(c, id, result)
+		return true
+	}
+
+	ctx, ok := c.addSubscription(id)
+	if !ok {
+		return false
+	}
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		c.subscribe(ctx, id, opts)
+	}()
+	return true
+}
+
+// subscribe executes an operation, sending its results until it completes or
+// the client stops it.
+func (c *wsConnection) subscribe(ctx context.Context, id string, opts *RequestOptions) {
+	var results chan *graphql.Result
+	var rejected bool
+	execute := func(ctx context.Context, ctxreq *fasthttp.RequestCtx, opts *RequestOptions) *graphql.Result {
+		op, result, _ := c.h.prepareOperation(ctx, ctxreq, opts)
+		if result != nil {
+			rejected = true
+			return result
+		}
+
+		if op.definition != nil && op.definition.Operation == ast.OperationTypeSubscription {
+			results = c.h.subscribeOperation(ctx, ctxreq, op)
+			return &graphql.Result{}
+		}
+		ctx, cancel := c.h.operationContext(ctx, ctxreq, c.h.operationTimeout(ctxreq, opts))
+		defer cancel()
+		return c.h.executeOperation(ctx, ctxreq, op)
+	}
+
+	result := c.h.runMiddlewares(ctx, c.ctxreq, opts, execute)
+	switch {
+	case rejected:
+		if c.removeSubscription(id) {
+			c.protocol.reject(c, id, result)
+		}
+		return
+	case results != nil:
+		// drain the channel even once stopped, so the executor can return
+		for result := range results {
+			if ctx.Err() == nil {
+				c.send(c.protocol.next(id, result))
+			}
+		}
+	default:
+		if ctx.Err() == nil {
+			c.send(c.protocol.next(id, result))
+		}
+	}
+
+	// the client is only told about operations it did not stop itself
+	if c.removeSubscription(id) {
+		c.send(c.protocol.complete(id))
+	}
+}
+
+// addSubscription registers the operation id, returning the context its
+// execution is bound to. It fails when the id is already in use.
+func (c *wsConnection) addSubscription(id string) (context.Context, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.subscriptions[id]; ok {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subscriptions[id] = cancel
+	return ctx, true
+}
+
+// activeOperations returns the number of operations running on the
+// connection.
+func (c *wsConnection) activeOperations() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.subscriptions)
+}
+
+// removeSubscription stops the operation id. It reports whether the operation
+// was still running.
+func (c *wsConnection) removeSubscription(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, ok := c.subscriptions[id]
+	if ok {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+	return ok
+}
+
+// send writes a message to the client.
+func (c *wsConnection) send(msg *wsOutgoingMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.WriteJSON(msg)
+}
+
+// closeWith closes the connection with a close code and reason.
+func (c *wsConnection) closeWith(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// close stops every running operation and closes the connection, waiting
+// for the goroutines writing to it.
+func (c *wsConnection) close() {
+	c.mu.Lock()
+	for id, cancel := range c.subscriptions {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Unlock()
+
+	close(c.done)
+	c.conn.Close()
+	c.workers.Wait()
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/fasthttp/websocket"
+	"github.com/graphql-go/graphql"
+)
+
+// graphql-ws message types of the legacy subscriptions-transport-ws protocol
+const (
+	gqlConnectionInit      = "connection_init"
+	gqlConnectionAck       = "connection_ack"
+	gqlConnectionError     = "connection_error"
+	gqlConnectionKeepAlive = "ka"
+	gqlConnectionTerminate = "connection_terminate"
+	gqlStart               = "start"
+	gqlData                = "data"
+	gqlError               = "error"
+	gqlComplete            = "complete"
+	gqlStop                = "stop"
+)
+
+// gqlErrorPayload is the payload of the connection_error and error messages.
+type gqlErrorPayload struct {
+	Message string `json:"message"`
+}
+
+// graphqlWSProtocol implements the legacy subscriptions-transport-ws protocol,
+// negotiated with the graphql-ws subprotocol.
+type graphqlWSProtocol struct{}
+
+func (graphqlWSProtocol) handleMessage(c *wsConnection, msg *wsMessage) bool {
+	switch msg.Type {
+	case gqlConnectionInit:
+		initialised, err := c.init(msg.Payload)
+		if initialised {
+			return true
+		}
+		if err != nil {
+			c.send(&wsOutgoingMessage{Type: gqlConnectionError, Payload: &gqlErrorPayload{Message: err.Error()}})
+			c.closeWith(websocket.CloseNormalClosure, "")
+			return false
+		}
+		c.send(&wsOutgoingMessage{Type: gqlConnectionAck})
+		if c.h.keepAliveInterval > 0 {
+			// legacy clients expect a first keep-alive right after the ack
+			c.send(&wsOutgoingMessage{Type: gqlConnectionKeepAlive})
+		}
+		c.startKeepAlive()
+		return true
+
+	case gqlStart:
+		if !c.isAcknowledged() {
+			c.send(&wsOutgoingMessage{ID: msg.ID, Type: gqlError, Payload: &gqlErrorPayload{Message: "Connection not initialised"}})
+			return true
+		}
+
+		var opts RequestOptions
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &opts) != nil {
+			c.send(&wsOutgoingMessage{ID: msg.ID, Type: gqlError, Payload: &gqlErrorPayload{Message: "Invalid message received"}})
+			return true
+		}
+		if !c.start(msg.ID, &opts) {
+			c.send(&wsOutgoingMessage{ID: msg.ID, Type: gqlError, Payload: &gqlErrorPayload{Message: "Subscriber for " + msg.ID + " already exists"}})
+		}
+		return true
+
+	case gqlStop:
+		c.removeSubscription(msg.ID)
+		return true
+
+	case gqlConnectionTerminate:
+		c.closeWith(websocket.CloseNormalClosure, "")
+		return false
+	}
+
+	c.send(&wsOutgoingMessage{ID: msg.ID, Type: gqlError, Payload: &gqlErrorPayload{Message: "Invalid message received"}})
+	return true
+}
+
+func (graphqlWSProtocol) keepAlive() *wsOutgoingMessage {
+	return &wsOutgoingMessage{Type: gqlConnectionKeepAlive}
+}
+
+func (graphqlWSProtocol) next(id string, result *graphql.Result) *wsOutgoingMessage {
+	return &wsOutgoingMessage{ID: id, Type: gqlData, Payload: result}
+}
+
+func (p graphqlWSProtocol) reject(c *wsConnection, id string, result *graphql.Result) {
+	// the legacy protocol reports validation errors as a result
+	c.send(p.next(id, result))
+	c.send(p.complete(id))
+}
+
+func (graphqlWSProtocol) complete(id string) *wsOutgoingMessage {
+	return &wsOutgoingMessage{ID: id, Type: gqlComplete}
+}
+
+func (graphqlWSProtocol) initTimeout(c *wsConnection) {
+	c.send(&wsOutgoingMessage{Type: gqlConnectionError, Payload: &gqlErrorPayload{Message: "Connection initialisation timeout"}})
+	c.closeWith(websocket.CloseNormalClosure, "")
+}
@@ -0,0 +1,358 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/fasthttp/websocket"
+	"github.com/graphql-go/graphql"
+	handler "github.com/nidrahou/graphql-fasthttp-handler"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsTestMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+func newCountdownSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Context.Value("user"), nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"countdown": &graphql.Field{
+					Type: graphql.Int,
+					Args: graphql.FieldConfigArgument{
+						"from": &graphql.ArgumentConfig{Type: graphql.Int},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						c := make(chan interface{})
+						go func() {
+							defer close(c)
+							for i := p.Args["from"].(int); i > 0; i-- {
+								select {
+								case <-p.Context.Done():
+									return
+								case c <- i:
+								}
+							}
+						}()
+						return c, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// serveWebSocketTest serves h on an in-memory listener and dials it with the
+// given subprotocols.
+func serveWebSocketTest(t *testing.T, h *handler.Handler, subprotocols ...string) *websocket.Conn {
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: h.ServeHTTP}
+	go server.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+
+	dialer := websocket.Dialer{
+		NetDial:      func(network, addr string) (net.Conn, error) { return ln.Dial() },
+		Subprotocols: subprotocols,
+	}
+	conn, _, err := dialer.Dial("ws://localhost/graphql", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readWebSocketMessage(t *testing.T, conn *websocket.Conn) *wsTestMessage {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var msg wsTestMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("unexpected error reading message: %v", err)
+	}
+	return &msg
+}
+
+func expectWebSocketClose(t *testing.T, conn *websocket.Conn, code int) {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, code) {
+		t.Fatalf("expected close code %d, got %v", code, err)
+	}
+}
+
+func TestWebSocket_TransportWS_Subscription(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	if conn.Subprotocol() != handler.ProtocolGraphQLTransportWS {
+		t.Fatalf("wrong subprotocol, got %q", conn.Subprotocol())
+	}
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	if msg := readWebSocketMessage(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{Type: "ping"})
+	if msg := readWebSocketMessage(t, conn); msg.Type != "pong" {
+		t.Fatalf("expected pong, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{
+		"query": "subscription { countdown(from: 3) }",
+	}})
+	for _, expected := range []float64{3, 2, 1} {
+		msg := readWebSocketMessage(t, conn)
+		data := map[string]interface{}{"data": map[string]interface{}{"countdown": expected}}
+		if msg.ID != "1" || msg.Type != "next" || !reflect.DeepEqual(msg.Payload, data) {
+			t.Fatalf("expected next %v, got %v", data, msg)
+		}
+	}
+	if msg := readWebSocketMessage(t, conn); msg.ID != "1" || msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "2", Type: "subscribe", Payload: map[string]interface{}{
+		"query": "subscription { unknown }",
+	}})
+	if msg := readWebSocketMessage(t, conn); msg.ID != "2" || msg.Type != "error" {
+		t.Fatalf("expected error, got %v", msg)
+	}
+}
+
+func TestWebSocket_TransportWS_ConnectionInitFn(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{
+		Schema: &schema,
+		ConnectionInitFn: func(ctx context.Context, header *fasthttp.RequestHeader, payload map[string]interface{}) (context.Context, error) {
+			token, _ := payload["token"].(string)
+			if token == "" {
+				return nil, errors.New("missing token")
+			}
+			return context.WithValue(ctx, "user", token), nil
+		},
+	})
+
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init", Payload: map[string]interface{}{"token": "luke"}})
+	if msg := readWebSocketMessage(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{"query": "{ user }"}})
+	msg := readWebSocketMessage(t, conn)
+	data := map[string]interface{}{"data": map[string]interface{}{"user": "luke"}}
+	if msg.Type != "next" || !reflect.DeepEqual(msg.Payload, data) {
+		t.Fatalf("expected next %v, got %v", data, msg)
+	}
+	if msg := readWebSocketMessage(t, conn); msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+
+	conn = serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	expectWebSocketClose(t, conn, 4403)
+}
+
+func TestWebSocket_TransportWS_SubscribeBeforeInit(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{"query": "{ user }"}})
+	expectWebSocketClose(t, conn, 4401)
+}
+
+func TestWebSocket_TransportWS_InitTimeout(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:                &schema,
+		ConnectionInitTimeout: 10 * time.Millisecond,
+	})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	expectWebSocketClose(t, conn, 4408)
+}
+
+func TestWebSocket_Negotiation(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLWS, handler.ProtocolGraphQLTransportWS)
+	if conn.Subprotocol() != handler.ProtocolGraphQLTransportWS {
+		t.Fatalf("expected %q to be preferred, got %q", handler.ProtocolGraphQLTransportWS, conn.Subprotocol())
+	}
+
+	conn = serveWebSocketTest(t, h, handler.ProtocolGraphQLWS)
+	if conn.Subprotocol() != handler.ProtocolGraphQLWS {
+		t.Fatalf("wrong subprotocol, got %q", conn.Subprotocol())
+	}
+}
+
+func TestWebSocket_GraphQLWS_Subscription(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLWS)
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	if msg := readWebSocketMessage(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("expected connection_ack, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "start", Payload: map[string]interface{}{
+		"query": "subscription { countdown(from: 2) }",
+	}})
+	for _, expected := range []float64{2, 1} {
+		msg := readWebSocketMessage(t, conn)
+		data := map[string]interface{}{"data": map[string]interface{}{"countdown": expected}}
+		if msg.ID != "1" || msg.Type != "data" || !reflect.DeepEqual(msg.Payload, data) {
+			t.Fatalf("expected data %v, got %v", data, msg)
+		}
+	}
+	if msg := readWebSocketMessage(t, conn); msg.ID != "1" || msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "2", Type: "start", Payload: map[string]interface{}{
+		"query": "subscription { unknown }",
+	}})
+	msg := readWebSocketMessage(t, conn)
+	payload, _ := msg.Payload.(map[string]interface{})
+	if msg.ID != "2" || msg.Type != "data" || payload["errors"] == nil {
+		t.Fatalf("expected data with errors, got %v", msg)
+	}
+	if msg := readWebSocketMessage(t, conn); msg.ID != "2" || msg.Type != "complete" {
+		t.Fatalf("expected complete, got %v", msg)
+	}
+
+	conn.WriteJSON(&wsTestMessage{ID: "3", Type: "start", Payload: map[string]interface{}{
+		"query": "subscription { countdown(from: 1000000) }",
+	}})
+	if msg := readWebSocketMessage(t, conn); msg.ID != "3" || msg.Type != "data" {
+		t.Fatalf("expected data, got %v", msg)
+	}
+	conn.WriteJSON(&wsTestMessage{ID: "3", Type: "stop"})
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_terminate"})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var msg wsTestMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("expected normal closure, got %v", err)
+			}
+			break
+		}
+		if msg.Type == "complete" {
+			t.Fatalf("unexpected complete of a stopped operation")
+		}
+	}
+}
+
+func TestWebSocket_GraphQLWS_ConnectionError(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{
+		Schema: &schema,
+		ConnectionInitFn: func(ctx context.Context, header *fasthttp.RequestHeader, payload map[string]interface{}) (context.Context, error) {
+			return nil, errors.New("missing token")
+		},
+	})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLWS)
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	msg := readWebSocketMessage(t, conn)
+	payload := map[string]interface{}{"message": "missing token"}
+	if msg.Type != "connection_error" || !reflect.DeepEqual(msg.Payload, payload) {
+		t.Fatalf("expected connection_error %v, got %v", payload, msg)
+	}
+	expectWebSocketClose(t, conn, websocket.CloseNormalClosure)
+}
+
+func TestWebSocket_KeepAlive(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{
+		Schema:            &schema,
+		KeepAliveInterval: 10 * time.Millisecond,
+	})
+
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLWS)
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	for _, expected := range []string{"connection_ack", "ka", "ka"} {
+		if msg := readWebSocketMessage(t, conn); msg.Type != expected {
+			t.Fatalf("expected %s, got %v", expected, msg)
+		}
+	}
+
+	conn = serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	for _, expected := range []string{"connection_ack", "ping"} {
+		if msg := readWebSocketMessage(t, conn); msg.Type != expected {
+			t.Fatalf("expected %s, got %v", expected, msg)
+		}
+	}
+}
+
+func TestWebSocket_ReadLimit(t *testing.T) {
+	schema := newCountdownSchema(t)
+	h := handler.New(&handler.Config{Schema: &schema, MaxBodyBytes: 64})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init", Payload: map[string]interface{}{
+		"token": strings.Repeat("x", 128),
+	}})
+	expectWebSocketClose(t, conn, websocket.CloseMessageTooBig)
+}
+
+func TestWebSocket_MaxOperations(t *testing.T) {
+	cancelled := make(chan error, 1)
+	schema := newSlowSchema(t, cancelled)
+	h := handler.New(&handler.Config{Schema: &schema, MaxWebSocketOperations: 1})
+	conn := serveWebSocketTest(t, h, handler.ProtocolGraphQLTransportWS)
+
+	conn.WriteJSON(&wsTestMessage{Type: "connection_init"})
+	readWebSocketMessage(t, conn)
+
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "subscribe", Payload: map[string]interface{}{"query": "{ slow }"}})
+	conn.WriteJSON(&wsTestMessage{ID: "2", Type: "subscribe", Payload: map[string]interface{}{"query": "{ fast }"}})
+	msg := readWebSocketMessage(t, conn)
+	payload, _ := json.Marshal(msg.Payload)
+	if msg.ID != "2" || msg.Type != "error" || !strings.Contains(string(payload), `"code":"TOO_MANY_OPERATIONS"`) {
+		t.Fatalf("expected a TOO_MANY_OPERATIONS error, got %v", msg)
+	}
+
+	// the connection serves further operations once the running one is done
+	conn.WriteJSON(&wsTestMessage{ID: "1", Type: "complete"})
+	<-cancelled
+	conn.WriteJSON(&wsTestMessage{ID: "3", Type: "subscribe", Payload: map[string]interface{}{"query": "{ fast }"}})
+	if msg := readWebSocketMessage(t, conn); msg.ID != "3" || msg.Type != "next" {
+		t.Fatalf("expected a result, got %v", msg)
+	}
+}
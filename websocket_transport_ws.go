@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+)
+
+// graphql-transport-ws message types
+const (
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsPing           = "ping"
+	wsPong           = "pong"
+	wsSubscribe      = "subscribe"
+	wsNext           = "next"
+	wsError          = "error"
+	wsComplete       = "complete"
+)
+
+// graphql-transport-ws close codes
+const (
+	wsCloseInvalidMessage      = 4400
+	wsCloseUnauthorized        = 4401
+	wsCloseForbidden           = 4403
+	wsCloseInitTimeout         = 4408
+	wsCloseSubscriberExists    = 4409
+	wsCloseTooManyInitRequests = 4429
+)
+
+// transportWSProtocol implements the graphql-transport-ws protocol.
+type transportWSProtocol struct{}
+
+func (transportWSProtocol) handleMessage(c *wsConnection, msg *wsMessage) bool {
+	switch msg.Type {
+	case wsConnectionInit:
+		initialised, err := c.init(msg.Payload)
+		if initialised {
+			c.closeWith(wsCloseTooManyInitRequests, "Too many initialisation requests")
+			return false
+		}
+		if err != nil {
+			c.closeWith(wsCloseForbidden, "Forbidden")
+			return false
+		}
+		c.send(&wsOutgoingMessage{Type: wsConnectionAck})
+		c.startKeepAlive()
+		return true
+
+	case wsPing:
+		c.send(&wsOutgoingMessage{Type: wsPong})
+		return true
+
+	case wsPong:
+		return true
+
+	case wsSubscribe:
+		if !c.isAcknowledged() {
+			c.closeWith(wsCloseUnauthorized, "Unauthorized")
+			return false
+		}
+
+		var opts RequestOptions
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &opts) != nil {
+			c.closeWith(wsCloseInvalidMessage, "Invalid message received")
+			return false
+		}
+		if !c.start(msg.ID, &opts) {
+			c.closeWith(wsCloseSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+			return false
+		}
+		return true
+
+	case wsComplete:
+		c.removeSubscription(msg.ID)
+		return true
+	}
+
+	c.closeWith(wsCloseInvalidMessage, "Invalid message received")
+	return false
+}
+
+func (transportWSProtocol) keepAlive() *wsOutgoingMessage {
+	return &wsOutgoingMessage{Type: wsPing}
+}
+
+func (transportWSProtocol) next(id string, result *graphql.Result) *wsOutgoingMessage {
+	return &wsOutgoingMessage{ID: id, Type: wsNext, Payload: result}
+}
+
+func (transportWSProtocol) reject(c *wsConnection, id string, result *graphql.Result) {
+	c.send(&wsOutgoingMessage{ID: id, Type: wsError, Payload: result.Errors})
+}
+
+func (transportWSProtocol) complete(id string) *wsOutgoingMessage {
+	return &wsOutgoingMessage{ID: id, Type: wsComplete}
+}
+
+func (transportWSProtocol) initTimeout(c *wsConnection) {
+	c.closeWith(wsCloseInitTimeout, "Connection initialisation timeout")
+}